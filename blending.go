@@ -0,0 +1,187 @@
+package gopsd
+
+import "math"
+
+// blendFunc mixes source color into backdrop color. Both are in range [0, 1].
+type blendFunc func(backdrop, source [3]float64) [3]float64
+
+var blendFuncs = map[string]blendFunc{
+	"Normal":        separable(func(b, s float64) float64 { return s }),
+	"Dissolve":      separable(func(b, s float64) float64 { return s }),
+	"Darken":        separable(math.Min),
+	"Multiply":      separable(func(b, s float64) float64 { return b * s }),
+	"Color burn":    separable(colorBurn),
+	"Linear burn":   separable(func(b, s float64) float64 { return math.Max(0, b+s-1) }),
+	"Darker color":  darkerColor,
+	"Lighten":       separable(math.Max),
+	"Screen":        separable(screen),
+	"Color dodge":   separable(colorDodge),
+	"Linear dodge":  separable(func(b, s float64) float64 { return math.Min(1, b+s) }),
+	"Lighter color": lighterColor,
+	"Overlay":       separable(func(b, s float64) float64 { return hardLight(s, b) }),
+	"Soft light":    separable(softLight),
+	"Hard light":    separable(hardLight),
+	"Vivid light":   separable(vividLight),
+	"Linear light":  separable(func(b, s float64) float64 { return clamp(b + 2*s - 1) }),
+	"Pin light":     separable(pinLight),
+	"Hard mix":      separable(hardMix),
+	"Difference":    separable(func(b, s float64) float64 { return math.Abs(b - s) }),
+	"Exclusion":     separable(func(b, s float64) float64 { return b + s - 2*b*s }),
+	"Subtract":      separable(func(b, s float64) float64 { return math.Max(0, b-s) }),
+	"Divide":        separable(divide),
+	"Hue":           func(b, s [3]float64) [3]float64 { return setLum(setSat(s, sat(b)), lum(b)) },
+	"Saturation":    func(b, s [3]float64) [3]float64 { return setLum(setSat(b, sat(s)), lum(b)) },
+	"Color":         func(b, s [3]float64) [3]float64 { return setLum(s, lum(b)) },
+	"Luminosity":    func(b, s [3]float64) [3]float64 { return setLum(b, lum(s)) },
+}
+
+// getBlendFunc returns blending function of mode name (see util.BlendModeKeys), "Normal" by default.
+func getBlendFunc(mode string) blendFunc {
+	if f, ok := blendFuncs[mode]; ok {
+		return f
+	}
+	return blendFuncs["Normal"]
+}
+
+func separable(f func(b, s float64) float64) blendFunc {
+	return func(b, s [3]float64) [3]float64 {
+		return [3]float64{f(b[0], s[0]), f(b[1], s[1]), f(b[2], s[2])}
+	}
+}
+
+func clamp(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+func screen(b, s float64) float64 {
+	return b + s - b*s
+}
+
+func colorBurn(b, s float64) float64 {
+	if b >= 1 {
+		return 1
+	}
+	if s <= 0 {
+		return 0
+	}
+	return 1 - math.Min(1, (1-b)/s)
+}
+
+func colorDodge(b, s float64) float64 {
+	if b <= 0 {
+		return 0
+	}
+	if s >= 1 {
+		return 1
+	}
+	return math.Min(1, b/(1-s))
+}
+
+func hardLight(b, s float64) float64 {
+	if s <= 0.5 {
+		return b * 2 * s
+	}
+	return screen(b, 2*s-1)
+}
+
+func softLight(b, s float64) float64 {
+	if s <= 0.5 {
+		return b - (1-2*s)*b*(1-b)
+	}
+	d := math.Sqrt(b)
+	if b <= 0.25 {
+		d = ((16*b-12)*b + 4) * b
+	}
+	return b + (2*s-1)*(d-b)
+}
+
+func vividLight(b, s float64) float64 {
+	if s <= 0.5 {
+		return colorBurn(b, 2*s)
+	}
+	return colorDodge(b, 2*s-1)
+}
+
+func pinLight(b, s float64) float64 {
+	if s <= 0.5 {
+		return math.Min(b, 2*s)
+	}
+	return math.Max(b, 2*s-1)
+}
+
+func hardMix(b, s float64) float64 {
+	if b+s >= 1 {
+		return 1
+	}
+	return 0
+}
+
+func divide(b, s float64) float64 {
+	if s <= 0 {
+		if b <= 0 {
+			return 0
+		}
+		return 1
+	}
+	return math.Min(1, b/s)
+}
+
+func darkerColor(b, s [3]float64) [3]float64 {
+	if lum(s) < lum(b) {
+		return s
+	}
+	return b
+}
+
+func lighterColor(b, s [3]float64) [3]float64 {
+	if lum(s) > lum(b) {
+		return s
+	}
+	return b
+}
+
+func lum(c [3]float64) float64 {
+	return 0.3*c[0] + 0.59*c[1] + 0.11*c[2]
+}
+
+func setLum(c [3]float64, l float64) [3]float64 {
+	d := l - lum(c)
+	c = [3]float64{c[0] + d, c[1] + d, c[2] + d}
+
+	l = lum(c)
+	n := math.Min(c[0], math.Min(c[1], c[2]))
+	x := math.Max(c[0], math.Max(c[1], c[2]))
+	for i := range c {
+		if n < 0 {
+			c[i] = l + (c[i]-l)*l/(l-n)
+		}
+		if x > 1 {
+			c[i] = l + (c[i]-l)*(1-l)/(x-l)
+		}
+	}
+	return c
+}
+
+func sat(c [3]float64) float64 {
+	return math.Max(c[0], math.Max(c[1], c[2])) - math.Min(c[0], math.Min(c[1], c[2]))
+}
+
+func setSat(c [3]float64, s float64) [3]float64 {
+	max, mid, min := 0, 1, 2
+	if c[max] < c[mid] {
+		max, mid = mid, max
+	}
+	if c[mid] < c[min] {
+		mid, min = min, mid
+	}
+	if c[max] < c[mid] {
+		max, mid = mid, max
+	}
+
+	var result [3]float64
+	if c[max] > c[min] {
+		result[mid] = (c[mid] - c[min]) * s / (c[max] - c[min])
+		result[max] = s
+	}
+	return result
+}
@@ -0,0 +1,407 @@
+package gopsd
+
+import (
+	"image"
+
+	"github.com/solovev/gopsd/types"
+)
+
+// bitmap stores not premultiplied RGBA pixels in range [0, 1].
+// Rect is in document coordinates.
+type bitmap struct {
+	Rect image.Rectangle
+	Pix  []float32
+}
+
+func newBitmap(rect image.Rectangle) *bitmap {
+	return &bitmap{rect, make([]float32, 4*rect.Dx()*rect.Dy())}
+}
+
+func (b *bitmap) offset(x, y int) int {
+	return 4 * ((y-b.Rect.Min.Y)*b.Rect.Dx() + (x - b.Rect.Min.X))
+}
+
+func (b *bitmap) at(x, y int) (c [3]float64, alpha float64) {
+	i := b.offset(x, y)
+	return [3]float64{float64(b.Pix[i]), float64(b.Pix[i+1]), float64(b.Pix[i+2])}, float64(b.Pix[i+3])
+}
+
+func (b *bitmap) set(x, y int, c [3]float64, alpha float64) {
+	i := b.offset(x, y)
+	b.Pix[i], b.Pix[i+1], b.Pix[i+2], b.Pix[i+3] = float32(c[0]), float32(c[1]), float32(c[2]), float32(alpha)
+}
+
+func (b *bitmap) clone() *bitmap {
+	pix := make([]float32, len(b.Pix))
+	copy(pix, b.Pix)
+	return &bitmap{b.Rect, pix}
+}
+
+// image converts bitmap into image with the same bounds.
+func (b *bitmap) image() *image.NRGBA {
+	img := image.NewNRGBA(b.Rect)
+	for i, value := range b.Pix {
+		img.Pix[i] = byte(clamp(float64(value))*255 + 0.5)
+	}
+	return img
+}
+
+// Composite renders visible layers into a single image the same size as document.
+// Unlike Document.Image (merged image saved by Photoshop) it is built from
+// layers, so it reflects any changes made to them after parsing.
+func (d *Document) Composite() (image.Image, error) {
+	canvas := newBitmap(image.Rect(0, 0, int(d.Width), int(d.Height)))
+	for _, node := range newRenderTree(d.Layers) {
+		node.compositeInto(canvas)
+	}
+	return canvas.image(), nil
+}
+
+// renderNode is a layer (or group) with layers clipped to it. Lists are ordered from bottom to top.
+type renderNode struct {
+	layer    *Layer
+	isGroup  bool
+	children []*renderNode
+	clipped  []*renderNode
+}
+
+// newRenderTree builds layers hierarchy from records ordered from bottom to top
+// (as they are stored in document), without changing Parent/Children of layers.
+func newRenderTree(layers []*Layer) []*renderNode {
+	stack := [][]*renderNode{nil}
+	for _, layer := range layers {
+		switch {
+		case layer.IsSectionDivider:
+			stack = append(stack, nil)
+		case layer.IsFolder:
+			children := stack[len(stack)-1]
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			} else {
+				children = nil
+			}
+			top := len(stack) - 1
+			stack[top] = append(stack[top], &renderNode{layer: layer, isGroup: true, children: attachClipped(children)})
+		default:
+			top := len(stack) - 1
+			stack[top] = append(stack[top], &renderNode{layer: layer})
+		}
+	}
+	return attachClipped(stack[0])
+}
+
+func attachClipped(nodes []*renderNode) []*renderNode {
+	var result []*renderNode
+	for _, node := range nodes {
+		if node.layer.Clipping != 0 && len(result) > 0 {
+			base := result[len(result)-1]
+			base.clipped = append(base.clipped, node)
+			continue
+		}
+		result = append(result, node)
+	}
+	return result
+}
+
+func (n *renderNode) compositeInto(canvas *bitmap) {
+	n.draw(canvas, false, nil, 1)
+}
+
+// clipInto composites node into the base content, keeping base's transparency.
+func (n *renderNode) clipInto(base *bitmap) {
+	n.draw(base, true, nil, 1)
+}
+
+// clipOnto composites node right into the canvas, limited by transparency of base content.
+// It is used when base layer doesn't blend clipped layers as group.
+func (n *renderNode) clipOnto(canvas, base *bitmap, baseOpacity float64) {
+	n.draw(canvas, false, base, baseOpacity)
+}
+
+// draw composites node with its effects into dst. If limit isn't nil, transparency of node is
+// multiplied by transparency of limit and limitOpacity.
+func (n *renderNode) draw(dst *bitmap, preserveAlpha bool, limit *bitmap, limitOpacity float64) {
+	layer := n.layer
+	if !layer.Visible {
+		return
+	}
+	opacity := float64(layer.Opacity) / 100
+
+	if n.isGroup && layer.BlendMode == "Pass through" && len(n.clipped) == 0 && !layer.hasEffects() && !preserveAlpha && limit == nil {
+		result := dst.clone()
+		for _, child := range n.children {
+			child.compositeInto(result)
+		}
+		mixBitmaps(dst, result, layer, opacity)
+		return
+	}
+
+	clipAsGroup := layer.BlendClippedElements || len(n.clipped) == 0
+	content, shape := n.render(dst.Rect, clipAsGroup)
+	if content == nil {
+		return
+	}
+	for _, part := range layer.applyEffects(content, shape) {
+		if limit != nil {
+			part.bitmap.limitBy(limit, limitOpacity)
+		}
+		options := blending{mode: part.mode, opacity: opacity * part.opacity, preserveAlpha: preserveAlpha}
+		if part.isContent {
+			options.layer = layer
+		}
+		blendBitmaps(dst, part.bitmap, options)
+	}
+	if !clipAsGroup {
+		for _, clipped := range n.clipped {
+			clipped.clipOnto(dst, shape, opacity)
+		}
+	}
+}
+
+// render returns content of node before applying its opacity and blend mode, and shape of content
+// before applying fill opacity. If withClipped is set, layers clipped to node are composited into the content.
+func (n *renderNode) render(rect image.Rectangle, withClipped bool) (content, shape *bitmap) {
+	layer := n.layer
+	if n.isGroup {
+		content = newBitmap(rect)
+		for _, child := range n.children {
+			child.compositeInto(content)
+		}
+	} else {
+		content = layer.content()
+	}
+	if content == nil {
+		return nil, nil
+	}
+	if !layer.LayerMaskHidesEffects || !layer.hasEffects() {
+		layer.applyMask(content)
+	}
+	if !layer.VectorMaskHidesEffects || !layer.hasEffects() {
+		layer.applyVectorMask(content)
+	}
+
+	shape = content
+	if layer.FillOpacity < 100 {
+		shape = content.clone()
+		fill := float32(layer.FillOpacity) / 100
+		for i := 3; i < len(content.Pix); i += 4 {
+			content.Pix[i] *= fill
+		}
+	}
+
+	if withClipped {
+		if shape == content {
+			shape = content.clone()
+		}
+		for _, clipped := range n.clipped {
+			clipped.clipInto(content)
+		}
+	}
+	return content, shape
+}
+
+// limitBy multiplies transparency of b by transparency of limit (zero outside of it) and opacity.
+func (b *bitmap) limitBy(limit *bitmap, opacity float64) {
+	for y := b.Rect.Min.Y; y < b.Rect.Max.Y; y++ {
+		for x := b.Rect.Min.X; x < b.Rect.Max.X; x++ {
+			alpha := float32(0)
+			if (image.Point{x, y}).In(limit.Rect) {
+				alpha = limit.Pix[limit.offset(x, y)+3] * float32(opacity)
+			}
+			b.Pix[b.offset(x, y)+3] *= alpha
+		}
+	}
+}
+
+// blending stores options of blendBitmaps. If preserveAlpha is set, transparency of dst
+// isn't changed (clipping mask). Layer is optional, its "Blend If" ranges and channel restrictions are applied.
+type blending struct {
+	mode          string
+	opacity       float64
+	layer         *Layer
+	preserveAlpha bool
+}
+
+// blendBitmaps composites src over dst.
+func blendBitmaps(dst, src *bitmap, options blending) {
+	blend := getBlendFunc(options.mode)
+	opacity, preserveAlpha, layer := options.opacity, options.preserveAlpha, options.layer
+	var restricted [3]bool
+	if layer != nil {
+		for _, channel := range layer.RestrictedChannels {
+			if channel >= 0 && channel < 3 {
+				restricted[channel] = true
+			}
+		}
+	}
+	rect := dst.Rect.Intersect(src.Rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			cs, as := src.at(x, y)
+			cb, ab := dst.at(x, y)
+			as *= opacity
+			if as <= 0 {
+				continue
+			}
+			if layer != nil {
+				as *= layer.blendIfWeight(cs, cb)
+				if as <= 0 {
+					continue
+				}
+			}
+
+			mixed := blend(cb, cs)
+			var co [3]float64
+			ao := as + ab*(1-as)
+			if preserveAlpha {
+				ao = ab
+			}
+			for i := range co {
+				c := (1-ab)*cs[i] + ab*mixed[i]
+				if restricted[i] && ab > 0 {
+					co[i] = cb[i]
+				} else if preserveAlpha {
+					co[i] = cb[i]*(1-as) + c*as
+				} else {
+					co[i] = (as*c + ab*cb[i]*(1-as)) / ao
+				}
+			}
+			dst.set(x, y, co, ao)
+		}
+	}
+}
+
+// mixBitmaps interpolates dst towards result (same rectangle) by opacity and mask of layer.
+// It is used for "Pass through" groups, which are composited right into the backdrop.
+func mixBitmaps(dst, result *bitmap, layer *Layer, opacity float64) {
+	for y := dst.Rect.Min.Y; y < dst.Rect.Max.Y; y++ {
+		for x := dst.Rect.Min.X; x < dst.Rect.Max.X; x++ {
+			t := opacity * layer.maskValue(x, y)
+			if t <= 0 {
+				continue
+			}
+			cb, ab := dst.at(x, y)
+			cr, ar := result.at(x, y)
+			a := ab + (ar-ab)*t
+			var c [3]float64
+			if a > 0 {
+				for i := range c {
+					c[i] = (cb[i]*ab + (cr[i]*ar-cb[i]*ab)*t) / a
+				}
+			}
+			dst.set(x, y, c, a)
+		}
+	}
+}
+
+// blendIfWeight returns visibility of source pixel over backdrop pixel according to "Blend If" sliders.
+func (l *Layer) blendIfWeight(source, backdrop [3]float64) float64 {
+	weight := 1.0
+	for i, ranges := range l.BlendingRanges {
+		if i > 3 {
+			break
+		}
+		var s, b float64
+		if i == 0 {
+			s, b = lum(source), lum(backdrop)
+		} else {
+			s, b = source[i-1], backdrop[i-1]
+		}
+		if !ranges.Source.IsDefault() {
+			weight *= ranges.Source.Weight(s)
+		}
+		if !ranges.Dest.IsDefault() {
+			weight *= ranges.Dest.Weight(b)
+		}
+	}
+	return weight
+}
+
+// content returns pixels of layer channels in document coordinates.
+func (l *Layer) content() *bitmap {
+	rect := l.Rectangle
+	if rect == nil || rect.Width <= 0 || rect.Height <= 0 {
+		return nil
+	}
+	b := newBitmap(image.Rect(int(rect.X), int(rect.Y), int(rect.X+rect.Width), int(rect.Y+rect.Height)))
+
+	red, green, blue, alpha := l.GetChannel(0), l.GetChannel(1), l.GetChannel(2), l.GetChannel(-1)
+	if green == nil && blue == nil { // Grayscale
+		green, blue = red, red
+	}
+	for i := 0; i < len(b.Pix)/4; i++ {
+		b.Pix[4*i] = channelValue(red, i, 0)
+		b.Pix[4*i+1] = channelValue(green, i, 0)
+		b.Pix[4*i+2] = channelValue(blue, i, 0)
+		b.Pix[4*i+3] = channelValue(alpha, i, 1)
+	}
+	return b
+}
+
+func channelValue(channel *LayerChannel, i int, def float32) float32 {
+	if channel == nil || i >= len(channel.Data) {
+		return def
+	}
+	return float32(byte(channel.Data[i])) / 255
+}
+
+// applyMask multiplies transparency of b by user supplied layer mask.
+func (l *Layer) applyMask(b *bitmap) {
+	if !l.HasMask() {
+		return
+	}
+	for y := b.Rect.Min.Y; y < b.Rect.Max.Y; y++ {
+		for x := b.Rect.Min.X; x < b.Rect.Max.X; x++ {
+			i := b.offset(x, y) + 3
+			b.Pix[i] *= float32(l.maskValue(x, y))
+		}
+	}
+}
+
+// applyVectorMask multiplies transparency of b by rasterized vector mask.
+func (l *Layer) applyVectorMask(b *bitmap) {
+	mask := l.VectorMask
+	if mask == nil || mask.IsDisabled || mask.Path == nil {
+		return
+	}
+	alpha := mask.Rasterize(b.Rect, 1)
+	for i, value := range alpha.Pix {
+		b.Pix[4*i+3] *= float32(value) / 255
+	}
+}
+
+// HasMask reports whether layer has enabled user supplied layer mask.
+func (l *Layer) HasMask() bool {
+	channel, _, _, flags := l.userMask()
+	return channel != nil && flags&(1<<1) == 0
+}
+
+// userMask returns channel, bounds, default color and flags of user supplied layer mask.
+// If layer has vector mask, Photoshop stores its rendering as layer mask (which isn't used,
+// vector mask is rasterized instead) and user supplied mask as the real one.
+func (l *Layer) userMask() (channel *LayerChannel, rect *types.Rectangle, defaultColor, flags byte) {
+	if l.MaskFlags&(1<<3) != 0 && l.VectorMask != nil {
+		if len(l.EnclosingMasks) < 2 {
+			return nil, nil, 0, 0
+		}
+		return l.GetChannel(-3), l.EnclosingMasks[1], l.MaskBackground, l.MaskRealFlags
+	}
+	if len(l.EnclosingMasks) == 0 {
+		return nil, nil, 0, 0
+	}
+	return l.GetChannel(-2), l.EnclosingMasks[0], l.DefaultColor, l.MaskFlags
+}
+
+// maskValue returns value of user supplied layer mask at document point in range [0, 1].
+func (l *Layer) maskValue(x, y int) float64 {
+	if !l.HasMask() {
+		return 1
+	}
+	channel, rect, defaultColor, _ := l.userMask()
+	x -= int(rect.X)
+	y -= int(rect.Y)
+	if x < 0 || y < 0 || x >= int(rect.Width) || y >= int(rect.Height) {
+		return float64(defaultColor) / 255
+	}
+	return float64(channelValue(channel, x+y*int(rect.Width), 1))
+}
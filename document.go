@@ -8,6 +8,9 @@ import (
 
 	"github.com/solovev/gopsd/types"
 	"github.com/solovev/gopsd/util"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
 )
 
 // TODO all INT -> INT64 (**PSB**)
@@ -30,13 +33,21 @@ type Document struct {
 	ColorMode string      `json:"-"`
 	Image     image.Image `json:"-"`
 
-	Resources map[int16]interface{} `json:"-"`
-	Layers    []*Layer
+	Resources     map[int16]interface{} `json:"-"`
+	ResourceNames map[int16]string      `json:"-"` // Names of resources, which have them
+	Paths         []*IRPath             `json:"-"` // Saved paths
+	Layers        []*Layer
+	Patterns      []*types.Pattern          `json:"-"`
+	LinkedFiles   map[string]*LinkedFile    `json:"-"` // Files of smart objects by unique ID
+	FilterEffects map[string]*FilterEffects `json:"-"` // Pixels of smart filters by placed ID of smart object
+
+	// Charset of Pascal strings: Shift-JIS for Japanese documents, MacRoman otherwise (see SetCharset)
+	Charset encoding.Encoding `json:"-"`
+
+	legacyResourceNames map[int16]string // Pascal string names of resources as is
 }
 
-var (
-	reader *util.Reader
-)
+var reader *util.Reader
 
 func (d *Document) GetLayersByName(name string) []*Layer {
 	var layers []*Layer
@@ -64,6 +75,16 @@ func (d *Document) GetLayer(index int) *Layer {
 	return d.Layers[index]
 }
 
+// GetPattern returns pattern with specified unique ID or nil.
+func (d *Document) GetPattern(id string) *types.Pattern {
+	for _, pattern := range d.Patterns {
+		if pattern.ID == id {
+			return pattern
+		}
+	}
+	return nil
+}
+
 func (d *Document) ToJSON() ([]byte, error) {
 	return json.Marshal(d)
 }
@@ -83,6 +104,7 @@ func (d *Document) GetTreeRepresentation() *Layer {
 		}
 
 		entry.Parent = current
+		entry.Children = nil // Tree may be built more than once
 		current.Children = append(current.Children, entry)
 
 		if entry.IsFolder {
@@ -113,10 +135,60 @@ func ParseFromBuffer(buffer []byte) (doc *Document, err error) {
 	readResources(doc)
 	readLayers(doc)
 	readImageData(doc)
+	doc.SetCharset(nil)
 
 	return doc, nil
 }
 
+// SetCharset decodes Pascal strings with charset: names of layers without Unicode name, names of resources
+// and font names of legacy text. Nil detects charset as parsing does. Documents saved on Windows may need charmap.Windows1252.
+func (d *Document) SetCharset(charset encoding.Encoding) {
+	if charset == nil {
+		charset = detectCharset(d)
+	}
+	d.Charset = charset
+	for _, layer := range d.Layers {
+		if !layer.unicodeName {
+			layer.Name = util.DecodeString(layer.legacyName, charset)
+		}
+		if tt := layer.ObsoleteTypeTool; tt != nil {
+			for _, face := range tt.Faces {
+				face.DecodeNames(charset)
+			}
+		}
+	}
+	for id, name := range d.legacyResourceNames {
+		d.ResourceNames[id] = util.DecodeString(name, charset)
+	}
+	for _, path := range d.Paths {
+		path.Name = d.ResourceNames[path.ID]
+	}
+	if clipping, ok := d.Resources[2999].(*IRClippingPath); ok {
+		clipping.Name = util.DecodeString(clipping.legacyName, charset)
+	}
+}
+
+// detectCharset returns Shift-JIS if Unicode names of layers are their Pascal names in Shift-JIS,
+// or if legacy text uses Japanese fonts. MacRoman otherwise.
+func detectCharset(doc *Document) encoding.Encoding {
+	for _, layer := range doc.Layers {
+		if layer.unicodeName && !util.IsASCII(layer.legacyName) {
+			if util.DecodeString(layer.legacyName, japanese.ShiftJIS) == layer.Name {
+				return japanese.ShiftJIS
+			}
+			return charmap.Macintosh
+		}
+		if tt := layer.ObsoleteTypeTool; tt != nil {
+			for _, face := range tt.Faces {
+				if face.Script == 1 {
+					return japanese.ShiftJIS
+				}
+			}
+		}
+	}
+	return charmap.Macintosh
+}
+
 func ParseFromPath(path string) (*Document, error) {
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -0,0 +1,786 @@
+package gopsd
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/solovev/gopsd/types"
+)
+
+// effectPart is a bitmap of layer content or effect, composited with its own blend mode and opacity.
+type effectPart struct {
+	bitmap    *bitmap
+	mode      string
+	opacity   float64
+	isContent bool
+}
+
+// hasEffects reports whether layer has any visible effect.
+func (l *Layer) hasEffects() bool {
+	e := l.Effects
+	if e == nil || !e.Enabled {
+		return false
+	}
+	for _, shadow := range e.DropShadows {
+		if shadow.Enabled {
+			return true
+		}
+	}
+	for _, shadow := range e.InnerShadows {
+		if shadow.Enabled {
+			return true
+		}
+	}
+	for _, overlay := range e.ColorOverlays {
+		if overlay.Enabled {
+			return true
+		}
+	}
+	for _, overlay := range e.GradientOverlays {
+		if overlay.Enabled {
+			return true
+		}
+	}
+	for _, stroke := range e.Strokes {
+		if stroke.Enabled {
+			return true
+		}
+	}
+	return (e.OuterGlow != nil && e.OuterGlow.Enabled) || (e.InnerGlow != nil && e.InnerGlow.Enabled) ||
+		(e.BevelEmboss != nil && e.BevelEmboss.Enabled) || (e.Satin != nil && e.Satin.Enabled) ||
+		(e.PatternOverlay != nil && e.PatternOverlay.Enabled)
+}
+
+// VisualRectangle returns bounds of layer including its effects.
+// Shadows, outer glows and strokes extend beyond Rectangle.
+func (l *Layer) VisualRectangle() *types.Rectangle {
+	r := l.Rectangle
+	rect := l.effectsRectangle(image.Rect(int(r.X), int(r.Y), int(r.X+r.Width), int(r.Y+r.Height)))
+	return types.CreateRectangle(int32(rect.Min.X), int32(rect.Min.Y), int32(rect.Dx()), int32(rect.Dy()))
+}
+
+// GetRenderedImage returns layer content with fill opacity, layer and vector masks and effects applied,
+// as it looks on transparent background. Image has bounds of VisualRectangle.
+func (l *Layer) GetRenderedImage() (image.Image, error) {
+	content, shape := (&renderNode{layer: l}).render(image.Rectangle{}, false)
+	if content == nil {
+		return nil, nil
+	}
+	r := l.VisualRectangle()
+	dst := newBitmap(image.Rect(int(r.X), int(r.Y), int(r.X+r.Width), int(r.Y+r.Height)))
+	for _, part := range l.applyEffects(content, shape) {
+		mode := part.mode
+		if part.isContent {
+			mode = "Normal"
+		}
+		blendBitmaps(dst, part.bitmap, blending{mode: mode, opacity: part.opacity})
+	}
+	return dst.image(), nil
+}
+
+// effectsRectangle extends bounds of layer content by size of effects.
+func (l *Layer) effectsRectangle(bounds image.Rectangle) image.Rectangle {
+	if !l.hasEffects() || bounds.Empty() {
+		return bounds
+	}
+	e := l.Effects
+	scale := e.Scale / 100
+	rect := bounds
+	extend := func(size float64) {
+		rect = rect.Union(bounds.Inset(-int(math.Ceil(size*scale)) - 1))
+	}
+
+	for _, shadow := range e.DropShadows {
+		if shadow.Enabled {
+			dx, dy := lightOffset(shadow.Angle, shadow.Distance*scale)
+			offset := image.Pt(int(math.Round(dx)), int(math.Round(dy)))
+			size := int(math.Ceil(shadow.Size*scale)) + 2
+			rect = rect.Union(bounds.Add(offset).Inset(-size))
+		}
+	}
+	if glow := e.OuterGlow; glow != nil && glow.Enabled {
+		extend(glow.Size)
+	}
+	for _, stroke := range e.Strokes {
+		if stroke.Enabled {
+			switch stroke.Position {
+			case "Outside":
+				extend(stroke.Size)
+			case "Center":
+				extend(stroke.Size / 2)
+			}
+		}
+	}
+	if bevel := e.BevelEmboss; bevel != nil && bevel.Enabled && bevel.Style != "Inner bevel" {
+		extend(bevel.Size)
+	}
+	return rect
+}
+
+// applyEffects returns parts of layer to composite from bottom to top:
+// effects below content, content with interior effects and effects above content.
+// Effects are built from shape, which is content before applying fill opacity.
+func (l *Layer) applyEffects(content, shape *bitmap) []*effectPart {
+	parts := []*effectPart{{content, l.BlendMode, 1, true}}
+	if !l.hasEffects() {
+		return parts
+	}
+	bounds := opaqueBounds(shape)
+	if bounds.Empty() {
+		return parts
+	}
+	e := l.Effects
+	fx := newEffectRenderer(l, shape, bounds, l.effectsRectangle(bounds))
+
+	var below, interior, above []*effectPart
+	for i := len(e.DropShadows) - 1; i >= 0; i-- {
+		if e.DropShadows[i].Enabled {
+			below = append(below, fx.dropShadow(e.DropShadows[i]))
+		}
+	}
+	if e.OuterGlow != nil && e.OuterGlow.Enabled {
+		below = append(below, fx.outerGlow(e.OuterGlow))
+	}
+
+	if e.PatternOverlay != nil && e.PatternOverlay.Enabled {
+		overlay := e.PatternOverlay
+		interior = append(interior, fx.fill(fx.interiorShape(), fx.patternColor(&overlay.PatternFill), overlay.BlendMode, overlay.Opacity))
+	}
+	for i := len(e.GradientOverlays) - 1; i >= 0; i-- {
+		if overlay := e.GradientOverlays[i]; overlay.Enabled {
+			interior = append(interior, fx.fill(fx.interiorShape(), fx.gradientColor(&overlay.GradientFill), overlay.BlendMode, overlay.Opacity))
+		}
+	}
+	for i := len(e.ColorOverlays) - 1; i >= 0; i-- {
+		if overlay := e.ColorOverlays[i]; overlay.Enabled {
+			interior = append(interior, fx.fill(fx.interiorShape(), solidColor(overlay.Color), overlay.BlendMode, overlay.Opacity))
+		}
+	}
+	if e.Satin != nil && e.Satin.Enabled {
+		interior = append(interior, fx.satin(e.Satin))
+	}
+	if e.InnerGlow != nil && e.InnerGlow.Enabled {
+		interior = append(interior, fx.innerGlow(e.InnerGlow))
+	}
+	for i := len(e.InnerShadows) - 1; i >= 0; i-- {
+		if e.InnerShadows[i].Enabled {
+			interior = append(interior, fx.innerShadow(e.InnerShadows[i]))
+		}
+	}
+
+	if e.BevelEmboss != nil && e.BevelEmboss.Enabled {
+		above = append(above, fx.bevelEmboss(e.BevelEmboss)...)
+	}
+	for i := len(e.Strokes) - 1; i >= 0; i-- {
+		if e.Strokes[i].Enabled {
+			above = append(above, fx.stroke(e.Strokes[i]))
+		}
+	}
+
+	if len(interior) > 0 {
+		result := newBitmap(fx.rect.Union(content.Rect))
+		blendBitmaps(result, content, blending{mode: "Normal", opacity: 1})
+		for _, part := range interior {
+			blendBitmaps(result, part.bitmap, blending{mode: part.mode, opacity: part.opacity})
+		}
+		parts[0].bitmap = result
+	}
+	parts = append(append(below, parts...), above...)
+
+	if l.LayerMaskHidesEffects {
+		for _, part := range parts {
+			l.applyMask(part.bitmap)
+		}
+	}
+	if l.VectorMaskHidesEffects {
+		for _, part := range parts {
+			l.applyVectorMask(part.bitmap)
+		}
+	}
+	return parts
+}
+
+// opaqueBounds returns bounds of not transparent pixels.
+func opaqueBounds(b *bitmap) image.Rectangle {
+	var rect image.Rectangle
+	for y := b.Rect.Min.Y; y < b.Rect.Max.Y; y++ {
+		for x := b.Rect.Min.X; x < b.Rect.Max.X; x++ {
+			if b.Pix[b.offset(x, y)+3] > 0 {
+				rect = rect.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return rect
+}
+
+// lightOffset returns offset of shadow cast by light coming from angle (degrees).
+func lightOffset(angle, distance float64) (dx, dy float64) {
+	angle *= math.Pi / 180
+	return -math.Cos(angle) * distance, math.Sin(angle) * distance
+}
+
+// alphaMap is a single channel bitmap.
+type alphaMap struct {
+	Rect image.Rectangle
+	Pix  []float32
+}
+
+func newAlphaMap(rect image.Rectangle) *alphaMap {
+	return &alphaMap{rect, make([]float32, rect.Dx()*rect.Dy())}
+}
+
+func (a *alphaMap) at(x, y int, outside float32) float32 {
+	if !(image.Point{x, y}).In(a.Rect) {
+		return outside
+	}
+	return a.Pix[(y-a.Rect.Min.Y)*a.Rect.Dx()+x-a.Rect.Min.X]
+}
+
+// apply returns new map with values mapped by f.
+func (a *alphaMap) apply(f func(i int, value float32) float32) *alphaMap {
+	result := newAlphaMap(a.Rect)
+	for i, value := range a.Pix {
+		result.Pix[i] = f(i, value)
+	}
+	return result
+}
+
+func (a *alphaMap) invert() *alphaMap {
+	return a.apply(func(i int, value float32) float32 { return 1 - value })
+}
+
+func (a *alphaMap) multiply(b *alphaMap) *alphaMap {
+	return a.apply(func(i int, value float32) float32 { return value * b.Pix[i] })
+}
+
+// shift moves map by (dx, dy) with bilinear interpolation. Pixels from outside of map get outside value.
+func (a *alphaMap) shift(dx, dy float64, outside float32) *alphaMap {
+	result := newAlphaMap(a.Rect)
+	ix, iy := int(math.Floor(dx)), int(math.Floor(dy))
+	fx, fy := float32(dx-math.Floor(dx)), float32(dy-math.Floor(dy))
+	for y := a.Rect.Min.Y; y < a.Rect.Max.Y; y++ {
+		for x := a.Rect.Min.X; x < a.Rect.Max.X; x++ {
+			sx, sy := x-ix, y-iy
+			top := a.at(sx, sy, outside)*(1-fx) + a.at(sx-1, sy, outside)*fx
+			bottom := a.at(sx, sy-1, outside)*(1-fx) + a.at(sx-1, sy-1, outside)*fx
+			result.Pix[(y-a.Rect.Min.Y)*a.Rect.Dx()+x-a.Rect.Min.X] = top*(1-fy) + bottom*fy
+		}
+	}
+	return result
+}
+
+// blur approximates gaussian blur reaching radius pixels by three box blurs.
+// Pixels outside of map have outside value.
+func (a *alphaMap) blur(radius float64, outside float32) *alphaMap {
+	r := int(math.Round(radius / 3))
+	if r < 1 {
+		if radius < 0.5 {
+			return a
+		}
+		r = 1
+	}
+	w, h := a.Rect.Dx(), a.Rect.Dy()
+	result := a.apply(func(i int, value float32) float32 { return value })
+	line := make([]float32, 0, w+h)
+	for pass := 0; pass < 3; pass++ {
+		for y := 0; y < h; y++ {
+			line = line[:0]
+			for x := 0; x < w; x++ {
+				line = append(line, result.Pix[y*w+x])
+			}
+			boxBlur(line, r, outside, func(x int, value float32) { result.Pix[y*w+x] = value })
+		}
+		for x := 0; x < w; x++ {
+			line = line[:0]
+			for y := 0; y < h; y++ {
+				line = append(line, result.Pix[y*w+x])
+			}
+			boxBlur(line, r, outside, func(y int, value float32) { result.Pix[y*w+x] = value })
+		}
+	}
+	return result
+}
+
+func boxBlur(line []float32, r int, outside float32, set func(i int, value float32)) {
+	value := func(i int) float32 {
+		if i < 0 || i >= len(line) {
+			return outside
+		}
+		return line[i]
+	}
+	var sum float32
+	for i := -r; i <= r; i++ {
+		sum += value(i)
+	}
+	size := float32(2*r + 1)
+	for i := range line {
+		set(i, sum/size)
+		sum += value(i+r+1) - value(i-r)
+	}
+}
+
+// effectRenderer renders effects of layer within rect from its shape.
+type effectRenderer struct {
+	layer  *Layer
+	rect   image.Rectangle
+	bounds image.Rectangle // Bounds of layer content
+	scale  float64
+	shape  *alphaMap
+	sdf    []float32 // Signed distance to the edge of shape (negative inside)
+}
+
+func newEffectRenderer(layer *Layer, shape *bitmap, bounds, rect image.Rectangle) *effectRenderer {
+	fx := &effectRenderer{layer: layer, rect: rect, bounds: bounds, scale: layer.Effects.Scale / 100}
+	fx.shape = newAlphaMap(rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			if (image.Point{x, y}).In(shape.Rect) {
+				fx.shape.Pix[(y-rect.Min.Y)*rect.Dx()+x-rect.Min.X] = shape.Pix[shape.offset(x, y)+3]
+			}
+		}
+	}
+	return fx
+}
+
+// distances returns signed distance field of shape, computed on first use.
+func (fx *effectRenderer) distances() []float32 {
+	if fx.sdf != nil {
+		return fx.sdf
+	}
+	w, h := fx.rect.Dx(), fx.rect.Dy()
+	inside := make([]bool, w*h)
+	for i, value := range fx.shape.Pix {
+		inside[i] = value >= 0.5
+	}
+	outer := distanceTransform(w, h, func(i int) bool { return inside[i] })
+	inner := distanceTransform(w, h, func(i int) bool { return !inside[i] })
+	fx.sdf = make([]float32, w*h)
+	for i := range fx.sdf {
+		if inside[i] {
+			fx.sdf[i] = -float32(math.Sqrt(inner[i]) - 0.5)
+		} else {
+			fx.sdf[i] = float32(math.Sqrt(outer[i]) - 0.5)
+		}
+	}
+	return fx.sdf
+}
+
+// distanceTransform returns squared euclidean distances to the nearest feature pixel.
+func distanceTransform(w, h int, feature func(i int) bool) []float64 {
+	const inf = 1e20
+	result := make([]float64, w*h)
+	for i := range result {
+		if !feature(i) {
+			result[i] = inf
+		}
+	}
+	n := w
+	if h > n {
+		n = h
+	}
+	f, d := make([]float64, n), make([]float64, n)
+	v, z := make([]int, n), make([]float64, n+1)
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			f[y] = result[y*w+x]
+		}
+		distanceTransform1D(f[:h], d[:h], v, z)
+		for y := 0; y < h; y++ {
+			result[y*w+x] = d[y]
+		}
+	}
+	for y := 0; y < h; y++ {
+		copy(f, result[y*w:(y+1)*w])
+		distanceTransform1D(f[:w], d[:w], v, z)
+		copy(result[y*w:(y+1)*w], d[:w])
+	}
+	return result
+}
+
+// distanceTransform1D is the lower envelope of parabolas (Felzenszwalb & Huttenlocher).
+func distanceTransform1D(f, d []float64, v []int, z []float64) {
+	k := 0
+	v[0] = 0
+	z[0], z[1] = math.Inf(-1), math.Inf(1)
+	for q := 1; q < len(f); q++ {
+		s := ((f[q] + float64(q*q)) - (f[v[k]] + float64(v[k]*v[k]))) / float64(2*q-2*v[k])
+		for s <= z[k] {
+			k--
+			s = ((f[q] + float64(q*q)) - (f[v[k]] + float64(v[k]*v[k]))) / float64(2*q-2*v[k])
+		}
+		k++
+		v[k] = q
+		z[k], z[k+1] = s, math.Inf(1)
+	}
+	k = 0
+	for q := range f {
+		for z[k+1] < float64(q) {
+			k++
+		}
+		d[q] = float64((q-v[k])*(q-v[k])) + f[v[k]]
+	}
+}
+
+func clamp32(value float32) float32 {
+	return float32(math.Max(0, math.Min(1, float64(value))))
+}
+
+// dilate returns shape extended by radius.
+func (fx *effectRenderer) dilate(radius float64) *alphaMap {
+	if radius <= 0 {
+		return fx.shape
+	}
+	sdf := fx.distances()
+	r := float32(radius)
+	return fx.shape.apply(func(i int, value float32) float32 {
+		return float32(math.Max(float64(value), float64(clamp32(r-sdf[i]+0.5))))
+	})
+}
+
+// erode returns shape shrunk by radius.
+func (fx *effectRenderer) erode(radius float64) *alphaMap {
+	if radius <= 0 {
+		return fx.shape
+	}
+	sdf := fx.distances()
+	r := float32(radius)
+	return fx.shape.apply(func(i int, value float32) float32 {
+		return float32(math.Min(float64(value), float64(clamp32(-r-sdf[i]+0.5))))
+	})
+}
+
+// interiorShape returns area of interior effects. If layer's transparency doesn't shape
+// effects ("Transparency shapes layer" is off), it is the whole content bounds.
+func (fx *effectRenderer) interiorShape() *alphaMap {
+	if fx.layer.TransparencyShapesLayer {
+		return fx.shape
+	}
+	return fx.shape.apply(func(i int, value float32) float32 {
+		x, y := fx.rect.Min.X+i%fx.rect.Dx(), fx.rect.Min.Y+i/fx.rect.Dx()
+		if (image.Point{x, y}).In(fx.bounds) {
+			return 1
+		}
+		return 0
+	})
+}
+
+// colorFunc returns color and opacity of effect at document point.
+type colorFunc func(x, y int) ([3]float64, float64)
+
+func solidColor(c color.NRGBA) colorFunc {
+	value := [3]float64{float64(c.R) / 255, float64(c.G) / 255, float64(c.B) / 255}
+	return func(x, y int) ([3]float64, float64) {
+		return value, 1
+	}
+}
+
+// fill creates effect part of alpha filled with colors. Opacity is in percent.
+func (fx *effectRenderer) fill(alpha *alphaMap, colors colorFunc, mode string, opacity float64) *effectPart {
+	b := newBitmap(fx.rect)
+	for y := fx.rect.Min.Y; y < fx.rect.Max.Y; y++ {
+		for x := fx.rect.Min.X; x < fx.rect.Max.X; x++ {
+			a := float64(alpha.at(x, y, 0))
+			if a <= 0 {
+				continue
+			}
+			c, ca := colors(x, y)
+			b.set(x, y, c, a*ca)
+		}
+	}
+	return &effectPart{b, mode, opacity / 100, false}
+}
+
+func (fx *effectRenderer) dropShadow(shadow *types.DropShadow) *effectPart {
+	size := shadow.Size * fx.scale
+	spread := shadow.Spread / 100
+	dx, dy := lightOffset(shadow.Angle, shadow.Distance*fx.scale)
+
+	alpha := fx.dilate(size*spread).blur(size*(1-spread), 0).shift(dx, dy, 0)
+	if shadow.LayerKnocksOut {
+		alpha = alpha.multiply(fx.shape.invert())
+	}
+	return fx.fill(alpha, solidColor(shadow.Color), shadow.BlendMode, shadow.Opacity)
+}
+
+func (fx *effectRenderer) innerShadow(shadow *types.InnerShadow) *effectPart {
+	size := shadow.Size * fx.scale
+	choke := shadow.Spread / 100
+	dx, dy := lightOffset(shadow.Angle, shadow.Distance*fx.scale)
+
+	alpha := fx.erode(size*choke).invert().blur(size*(1-choke), 1).shift(dx, dy, 1).multiply(fx.shape)
+	return fx.fill(alpha, solidColor(shadow.Color), shadow.BlendMode, shadow.Opacity)
+}
+
+func (fx *effectRenderer) outerGlow(glow *types.OuterGlow) *effectPart {
+	size := glow.Size * fx.scale
+	spread := glow.Spread / 100
+	alpha := fx.dilate(size*spread).blur(size*(1-spread), 0)
+	return fx.fill(alpha, fx.glowColor(&glow.Glow, alpha), glow.BlendMode, glow.Opacity)
+}
+
+func (fx *effectRenderer) innerGlow(glow *types.InnerGlow) *effectPart {
+	size := glow.Size * fx.scale
+	choke := glow.Spread / 100
+	alpha := fx.erode(size*choke).invert().blur(size*(1-choke), 1)
+	if glow.Source == "Center" {
+		alpha = alpha.invert()
+	}
+	alpha = alpha.multiply(fx.shape)
+	return fx.fill(alpha, fx.glowColor(&glow.Glow, alpha), glow.BlendMode, glow.Opacity)
+}
+
+// glowColor returns color of glow. Gradient glows go from the first stop at the edge of shape to the last one.
+func (fx *effectRenderer) glowColor(glow *types.Glow, alpha *alphaMap) colorFunc {
+	if glow.Gradient == nil {
+		return solidColor(glow.Color)
+	}
+	return func(x, y int) ([3]float64, float64) {
+		return gradientColor(glow.Gradient, 1-float64(alpha.at(x, y, 0)))
+	}
+}
+
+func (fx *effectRenderer) satin(satin *types.Satin) *effectPart {
+	size := satin.Size * fx.scale
+	dx, dy := lightOffset(satin.Angle, satin.Distance*fx.scale)
+	first := fx.shape.shift(dx, dy, 0).blur(size, 0)
+	second := fx.shape.shift(-dx, -dy, 0).blur(size, 0)
+	alpha := first.apply(func(i int, value float32) float32 {
+		value = float32(math.Abs(float64(value - second.Pix[i])))
+		if satin.Invert {
+			value = 1 - value
+		}
+		return value * fx.shape.Pix[i]
+	})
+	return fx.fill(alpha, solidColor(satin.Color), satin.BlendMode, satin.Opacity)
+}
+
+func (fx *effectRenderer) stroke(stroke *types.Stroke) *effectPart {
+	size := stroke.Size * fx.scale
+	var outer, inner *alphaMap
+	switch stroke.Position {
+	case "Inside":
+		outer, inner = fx.shape, fx.erode(size)
+	case "Center":
+		outer, inner = fx.dilate(size/2), fx.erode(size/2)
+	default:
+		outer, inner = fx.dilate(size), fx.shape
+	}
+	alpha := outer.apply(func(i int, value float32) float32 {
+		return clamp32(value - inner.Pix[i])
+	})
+
+	colors := solidColor(stroke.Color)
+	switch {
+	case stroke.FillType == "Gradient" && stroke.Gradient != nil:
+		colors = fx.gradientColor(stroke.Gradient)
+	case stroke.FillType == "Pattern" && stroke.Pattern != nil:
+		colors = fx.patternColor(stroke.Pattern)
+	}
+	return fx.fill(alpha, colors, stroke.BlendMode, stroke.Opacity)
+}
+
+// bevelEmboss lights height map built from shape, returning highlight and shadow parts.
+func (fx *effectRenderer) bevelEmboss(bevel *types.BevelEmboss) []*effectPart {
+	size := math.Max(1, bevel.Size*fx.scale)
+	sdf := fx.distances()
+	w, h := fx.rect.Dx(), fx.rect.Dy()
+
+	height := fx.shape.apply(func(i int, value float32) float32 {
+		d := float64(sdf[i])
+		var v float64
+		switch bevel.Style {
+		case "Outer bevel":
+			v = 1 - d/size
+		case "Emboss", "Stroke emboss":
+			v = 0.5 - d/(2*size)
+		case "Pillow emboss":
+			v = -d / size
+			if d > 0 {
+				v = d / size
+			}
+		default:
+			v = -d / size
+		}
+		v = math.Max(0, math.Min(1, v))
+		if bevel.Technique == "Smooth" {
+			v = v * v * (3 - 2*v)
+		}
+		if !bevel.Up {
+			v = -v
+		}
+		return float32(v)
+	}).blur(math.Max(bevel.Soften*fx.scale, 1.5), 0) // Smooth steps of distance field
+
+	angle := bevel.Angle * math.Pi / 180
+	altitude := bevel.Altitude * math.Pi / 180
+	light := [3]float64{math.Cos(altitude) * math.Cos(angle), -math.Cos(altitude) * math.Sin(angle), math.Sin(altitude)}
+	depth := size * bevel.Depth / 100
+
+	highlight, shadow := newAlphaMap(fx.rect), newAlphaMap(fx.rect)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := y*w + x
+			d := float64(sdf[i])
+			var region float64
+			switch bevel.Style {
+			case "Outer bevel":
+				region = 1 - float64(fx.shape.Pix[i])
+			case "Inner bevel":
+				region = float64(fx.shape.Pix[i])
+			default:
+				region = 1
+			}
+			if region <= 0 || math.Abs(d) > size+1 {
+				continue
+			}
+			px, py := fx.rect.Min.X+x, fx.rect.Min.Y+y
+			gx := float64(height.at(px+1, py, 0)-height.at(px-1, py, 0)) / 2 * depth
+			gy := float64(height.at(px, py+1, 0)-height.at(px, py-1, 0)) / 2 * depth
+			length := math.Sqrt(gx*gx + gy*gy + 1)
+			shade := (-gx*light[0]-gy*light[1]+light[2])/length - light[2]
+			if shade > 0 {
+				highlight.Pix[i] = float32(region * math.Min(1, shade/(1-light[2]+1e-6)))
+			} else {
+				shadow.Pix[i] = float32(region * math.Min(1, -shade/(1+light[2])))
+			}
+		}
+	}
+	return []*effectPart{
+		fx.fill(shadow, solidColor(bevel.ShadowColor), bevel.ShadowBlendMode, bevel.ShadowOpacity),
+		fx.fill(highlight, solidColor(bevel.HighlightColor), bevel.HighlightBlendMode, bevel.HighlightOpacity),
+	}
+}
+
+// gradientColor returns colors of gradient fill placed over layer bounds (or document if not aligned with layer).
+func (fx *effectRenderer) gradientColor(fill *types.GradientFill) colorFunc {
+	bounds := fx.bounds
+	if !fill.AlignWithLayer && fx.layer.document != nil {
+		bounds = image.Rect(0, 0, int(fx.layer.document.Width), int(fx.layer.document.Height))
+	}
+	return func(x, y int) ([3]float64, float64) {
+		return gradientColor(fill.Gradient, gradientPosition(fill, bounds, float64(x)+0.5, float64(y)+0.5))
+	}
+}
+
+// gradientPosition returns position on gradient [0, 1] of point within bounds.
+func gradientPosition(fill *types.GradientFill, bounds image.Rectangle, x, y float64) float64 {
+	w, h := float64(bounds.Dx()), float64(bounds.Dy())
+	cx := float64(bounds.Min.X) + w/2 + fill.OffsetX/100*w
+	cy := float64(bounds.Min.Y) + h/2 + fill.OffsetY/100*h
+	angle := fill.Angle * math.Pi / 180
+	cos, sin := math.Cos(angle), math.Sin(angle)
+	scale := math.Max(fill.Scale, 1) / 100
+
+	// Half length of gradient line crossing bounds at angle
+	length := math.Max((math.Abs(w*cos)+math.Abs(h*sin))/2*scale, 1e-6)
+	dx, dy := x-cx, y-cy
+	along := dx*cos - dy*sin
+	across := dx*sin + dy*cos
+
+	var t float64
+	switch fill.Style {
+	case "Radial":
+		t = math.Hypot(dx, dy) / length
+	case "Angle":
+		a := math.Atan2(-dy, dx) - angle
+		t = math.Mod(a/(2*math.Pi)+2, 1)
+	case "Reflected":
+		t = math.Abs(along) / length
+	case "Diamond":
+		t = (math.Abs(along) + math.Abs(across)) / length
+	default:
+		t = 0.5 + along/(2*length)
+	}
+	t = math.Max(0, math.Min(1, t))
+	if fill.Reverse {
+		t = 1 - t
+	}
+	return t
+}
+
+// gradientColor returns color and opacity of gradient at position t [0, 1].
+func gradientColor(gradient *types.Gradient, t float64) ([3]float64, float64) {
+	if gradient == nil {
+		return [3]float64{}, 1
+	}
+	var c [3]float64
+	if stops := gradient.Colors; len(stops) > 0 {
+		from, to, f := gradientStops(len(stops), func(i int) (float64, float64) { return stops[i].Location, stops[i].Midpoint }, t)
+		a, b := stops[from].Color, stops[to].Color
+		c = [3]float64{
+			(float64(a.R) + (float64(b.R)-float64(a.R))*f) / 255,
+			(float64(a.G) + (float64(b.G)-float64(a.G))*f) / 255,
+			(float64(a.B) + (float64(b.B)-float64(a.B))*f) / 255,
+		}
+	}
+	alpha := 1.0
+	if stops := gradient.Opacities; len(stops) > 0 {
+		from, to, f := gradientStops(len(stops), func(i int) (float64, float64) { return stops[i].Location, stops[i].Midpoint }, t)
+		alpha = (stops[from].Opacity + (stops[to].Opacity-stops[from].Opacity)*f) / 100
+	}
+	return c, alpha
+}
+
+// gradientStops finds stops around t and interpolation factor between them. Midpoint between
+// two stops is stored in the second one. Before the first and after the last stop both indices are the same.
+func gradientStops(n int, stop func(i int) (location, midpoint float64), t float64) (from, to int, f float64) {
+	if location, _ := stop(0); t <= location {
+		return 0, 0, 0
+	}
+	for i := 1; i < n; i++ {
+		next, _ := stop(i)
+		if t > next {
+			continue
+		}
+		location, _ := stop(i - 1)
+		_, midpoint := stop(i)
+		f = 0
+		if next > location {
+			f = (t - location) / (next - location)
+		}
+		if midpoint > 0 && midpoint < 1 {
+			if f < midpoint {
+				f = f / midpoint / 2
+			} else {
+				f = 0.5 + (f-midpoint)/(1-midpoint)/2
+			}
+		}
+		return i - 1, i, f
+	}
+	return n - 1, n - 1, 0
+}
+
+// patternColor returns colors of tiled pattern. Missing and empty patterns are rendered as transparent.
+func (fx *effectRenderer) patternColor(fill *types.PatternFill) colorFunc {
+	var pattern *types.Pattern
+	if fx.layer.document != nil {
+		pattern = fx.layer.document.GetPattern(fill.ID)
+	}
+	if pattern == nil || pattern.Image == nil || pattern.Image.Bounds().Empty() {
+		return func(x, y int) ([3]float64, float64) {
+			return [3]float64{}, 0
+		}
+	}
+	img := pattern.Image
+	size := img.Bounds().Size()
+	scale := math.Max(fill.Scale, 1) / 100
+	var originX, originY float64
+	if fill.AlignWithLayer {
+		originX, originY = float64(fx.bounds.Min.X), float64(fx.bounds.Min.Y)
+	}
+	originX += fill.PhaseX
+	originY += fill.PhaseY
+	return func(x, y int) ([3]float64, float64) {
+		u := int(math.Floor((float64(x)+0.5-originX)/scale)) % size.X
+		v := int(math.Floor((float64(y)+0.5-originY)/scale)) % size.Y
+		if u < 0 {
+			u += size.X
+		}
+		if v < 0 {
+			v += size.Y
+		}
+		c := color.NRGBAModel.Convert(img.At(img.Bounds().Min.X+u, img.Bounds().Min.Y+v)).(color.NRGBA)
+		return [3]float64{float64(c.R) / 255, float64(c.G) / 255, float64(c.B) / 255}, float64(c.A) / 255
+	}
+}
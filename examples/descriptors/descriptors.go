@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/solovev/gopsd"
+	"github.com/solovev/gopsd/types"
+)
+
+// Writes descriptors of test.psd back and checks that they match bytes of file.
+func main() {
+	data, err := ioutil.ReadFile("../test.psd")
+	checkError(err)
+	doc, err := gopsd.ParseFromBuffer(data)
+	checkError(err)
+
+	failed := 0
+	for _, layer := range doc.Layers {
+		descriptors := map[string]*types.Descriptor{"vogk": layer.VectorOriginData}
+		if layer.TypeTool != nil {
+			descriptors["TySh text"] = layer.TypeTool.TextData
+			descriptors["TySh warp"] = layer.TypeTool.WarpData
+		}
+		if layer.Effects != nil {
+			descriptors["lfx2"] = layer.Effects.Descriptor
+		}
+		if layer.SmartObject != nil {
+			descriptors["SoLd"] = layer.SmartObject.Descriptor
+		}
+		for key, d := range descriptors {
+			if d != nil && !roundTrip(data, d) {
+				fmt.Printf("%s: %s differs\n", layer.Name, key)
+				failed++
+			}
+		}
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+	fmt.Println("All descriptors are written as they were read")
+}
+
+// roundTrip checks descriptor and its nested descriptors.
+func roundTrip(data []byte, d *types.Descriptor) bool {
+	b, err := types.Marshal(d)
+	if err != nil || !bytes.Contains(data, b) {
+		return false
+	}
+	for _, item := range d.Items {
+		if nested, ok := item.Value.(*types.Descriptor); ok && !roundTrip(data, nested) {
+			return false
+		}
+	}
+	return true
+}
+
+func checkError(err error) {
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,101 @@
+package gopsd
+
+import (
+	"image"
+
+	"github.com/solovev/gopsd/types"
+)
+
+// FilterEffects stores pixels of smart filters of smart object layer ("FEid" and "FXid" blocks).
+type FilterEffects struct {
+	ID        string // Placed ID of smart object (see types.SmartObject)
+	Rectangle *types.Rectangle
+	Depth     int32
+	Channels  []*LayerChannel // Filtered content in order of file, Data is nil if channel isn't written
+	Mask      *FilterMask     // Nil if smart filters have no mask
+}
+
+// FilterMask is mask of smart filters, it limits area where filters are applied.
+type FilterMask struct {
+	Rectangle *types.Rectangle
+	Data      []int8
+}
+
+// FilterEffects returns pixels of smart filters of smart object layer or nil.
+func (l *Layer) FilterEffects() *FilterEffects {
+	if l.SmartObject == nil || l.document == nil {
+		return nil
+	}
+	if fx, ok := l.document.FilterEffects[l.SmartObject.PlacedID]; ok {
+		return fx
+	}
+	return l.document.FilterEffects[l.SmartObject.ID]
+}
+
+// Image returns filter mask of 8-bit document as grayscale image in document coordinates.
+func (m *FilterMask) Image() *image.Gray {
+	r := m.Rectangle
+	img := image.NewGray(image.Rect(int(r.X), int(r.Y), int(r.X+r.Width), int(r.Y+r.Height)))
+	for i := 0; i < len(img.Pix) && i < len(m.Data); i++ {
+		img.Pix[i] = byte(m.Data[i])
+	}
+	return img
+}
+
+// readFilterEffects reads filter effects of smart objects.
+func readFilterEffects(doc *Document) {
+	if doc.FilterEffects == nil {
+		doc.FilterEffects = make(map[string]*FilterEffects)
+	}
+	reader.Skip(4) // Version (= 1, 2 or 3)
+	length := reader.ReadInt64()
+	end := reader.Position + int(length)
+	for end-reader.Position > 0 {
+		fx := &FilterEffects{ID: reader.ReadPascalString()}
+		reader.Skip(4) // Version (= 1)
+		length = reader.ReadInt64()
+		fxEnd := reader.Position + int(length)
+		readFilterEffect(fx, fxEnd)
+		doc.FilterEffects[fx.ID] = fx
+		reader.Skip(fxEnd - reader.Position)
+	}
+}
+
+func readFilterEffect(fx *FilterEffects, end int) {
+	fx.Rectangle = types.NewRectangle(reader)
+	fx.Depth = reader.ReadInt32()
+	count := int(reader.ReadInt32()) + 2 // Maximum number of channels, two more are always written
+	size := int(fx.Depth+7) / 8
+	for i := 0; i < count; i++ {
+		channel := &LayerChannel{ID: int16(i)}
+		fx.Channels = append(fx.Channels, channel)
+		if reader.ReadInt32() == 0 {
+			continue
+		}
+		channel.Length = reader.ReadInt64()
+		start := reader.Position
+		channel.Data = readFilterData(int(fx.Rectangle.Width)*size, int(fx.Rectangle.Height), int(channel.Length))
+		reader.Skip(start + int(channel.Length) - reader.Position)
+	}
+
+	if end-reader.Position <= 0 || reader.ReadByte() == 0 {
+		return
+	}
+	mask := &FilterMask{Rectangle: types.NewRectangle(reader)}
+	length := int(reader.ReadInt64())
+	start := reader.Position
+	if length > 0 {
+		mask.Data = readFilterData(int(mask.Rectangle.Width)*size, int(mask.Rectangle.Height), length)
+	}
+	reader.Skip(start + length - reader.Position)
+	fx.Mask = mask
+}
+
+// readFilterData reads compression method and pixels of channel, nil if method isn't supported.
+func readFilterData(width, height, length int) []int8 {
+	if length < 2 {
+		return nil
+	}
+	data, _ := readChannelData(reader.ReadInt16(), width, height)
+	return data
+}
@@ -0,0 +1,125 @@
+package gopsd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+)
+
+// Fonts is a set of TrueType and OpenType fonts for rendering of text layers.
+// Fonts are looked up by PostScript names, as they are stored in documents.
+type Fonts struct {
+	Fallback *sfnt.Font // Used for missing fonts. The first added font by default
+
+	fonts map[string]*sfnt.Font
+	faces map[fontFace]font.Face
+}
+
+type fontFace struct {
+	font *sfnt.Font
+	size float64
+}
+
+func NewFonts() *Fonts {
+	return &Fonts{fonts: make(map[string]*sfnt.Font), faces: make(map[fontFace]font.Face)}
+}
+
+// LoadFonts loads fonts (.ttf, .otf, .ttc and .otc files) from directory and its subdirectories.
+// Files which can't be parsed are skipped, it is an error if there are no fonts at all.
+func LoadFonts(dir string) (*Fonts, error) {
+	var paths []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".ttf", ".otf", ".ttc", ".otc":
+			if !info.IsDir() {
+				paths = append(paths, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	fonts := NewFonts()
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		fonts.Add(data)
+	}
+	if fonts.Fallback == nil {
+		return nil, fmt.Errorf("There are no fonts in \"%s\"", dir)
+	}
+	return fonts, nil
+}
+
+// Add parses font or font collection and adds its fonts.
+func (f *Fonts) Add(data []byte) error {
+	collection, err := opentype.ParseCollection(data)
+	if err != nil {
+		return err
+	}
+	var buffer sfnt.Buffer
+	for i := 0; i < collection.NumFonts(); i++ {
+		value, err := collection.Font(i)
+		if err != nil {
+			return err
+		}
+		name, err := value.Name(&buffer, sfnt.NameIDPostScript)
+		if err != nil {
+			return err
+		}
+		if _, ok := f.fonts[name]; !ok {
+			f.fonts[name] = value
+		}
+		if f.Fallback == nil {
+			f.Fallback = value
+		}
+	}
+	return nil
+}
+
+// Font returns font by its PostScript name, or fallback font if there is no such font.
+func (f *Fonts) Font(name string) *sfnt.Font {
+	if value, ok := f.fonts[name]; ok {
+		return value
+	}
+	return f.Fallback
+}
+
+// Has tells if there is font with specified PostScript name.
+func (f *Fonts) Has(name string) bool {
+	_, ok := f.fonts[name]
+	return ok
+}
+
+// face returns face of font of specified size in pixels.
+func (f *Fonts) face(name string, size float64) (font.Face, error) {
+	value := f.Font(name)
+	if value == nil {
+		return nil, fmt.Errorf("There is no font \"%s\" and no fallback font", name)
+	}
+	key := fontFace{value, size}
+	if face, ok := f.faces[key]; ok {
+		return face, nil
+	}
+	face, err := opentype.NewFace(value, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingNone})
+	if err != nil {
+		return nil, err
+	}
+	f.faces[key] = face
+	return face, nil
+}
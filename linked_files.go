@@ -0,0 +1,122 @@
+package gopsd
+
+import (
+	"fmt"
+
+	"github.com/solovev/gopsd/types"
+	"github.com/solovev/gopsd/util"
+)
+
+// LinkedFile is a file placed into smart object layers ("lnk2", "lnkD", "lnk3" and "lnkE" blocks).
+// Smart objects refer to it by ID (see types.SmartObject).
+type LinkedFile struct {
+	Type     string // "liFD" = embedded, "liFE" = external, "liFA" = alias
+	Version  int32
+	ID       string
+	Name     string // Original file name
+	FileType string // Mac OS file type, e.g. "8BPS"
+	Creator  string // Mac OS file creator, e.g. "8BIM"
+	Data     []byte // Contents of embedded file, or copy of external file saved by version 2 of "liFE"
+
+	Path           string            // Path of external file
+	OpenDescriptor *types.Descriptor // Parameters of opening file (e.g. page of PDF), may be nil
+	LinkDescriptor *types.Descriptor // Location of external file
+	ChildID        string
+}
+
+// IsDocument reports whether Data is a PSD or PSB document.
+func (f *LinkedFile) IsDocument() bool {
+	return len(f.Data) >= 4 && string(f.Data[:4]) == "8BPS"
+}
+
+// Open parses embedded PSD or PSB document.
+func (f *LinkedFile) Open() (*Document, error) {
+	if len(f.Data) == 0 {
+		return nil, fmt.Errorf("Linked file \"%s\" has no data", f.Name)
+	}
+	if !f.IsDocument() {
+		return nil, fmt.Errorf("Linked file \"%s\" is not a PSD or PSB document", f.Name)
+	}
+	parent := reader
+	defer func() {
+		reader = parent
+	}()
+	return ParseFromBuffer(f.Data)
+}
+
+// readLinkedFiles reads records of linked files up to end.
+func readLinkedFiles(doc *Document, end int) {
+	if doc.LinkedFiles == nil {
+		doc.LinkedFiles = make(map[string]*LinkedFile)
+	}
+	for end-reader.Position >= 8 {
+		length := int(reader.ReadInt64())
+		pos := reader.Position
+		file := readLinkedFile(pos + length)
+		doc.LinkedFiles[file.ID] = file
+		reader.Skip(pos + (length+3)&^0x03 - reader.Position)
+	}
+}
+
+// readLinkedFile reads record of linked file, which ends at end.
+func readLinkedFile(end int) *LinkedFile {
+	file := new(LinkedFile)
+	file.Type = reader.ReadString(4)
+	file.Version = reader.ReadInt32()
+	file.ID = reader.ReadPascalString()
+	file.Name = reader.ReadUnicodeString()
+	file.FileType = reader.ReadString(4)
+	file.Creator = reader.ReadString(4)
+	size := reader.ReadInt64()
+	if reader.ReadByte() != 0 {
+		reader.Skip(4) // Descriptor version (= 16)
+		file.OpenDescriptor = readRecordDescriptor(end)
+	}
+
+	switch file.Type {
+	case "liFD":
+		file.Data = reader.ReadBytes(int(size))
+	case "liFE":
+		reader.Skip(4) // Descriptor version (= 16)
+		file.LinkDescriptor = readRecordDescriptor(end)
+		var link struct {
+			FullPath     string `psd:"fullPath"`
+			OriginalPath string `psd:"originalPath"`
+			RelativePath string `psd:"relPath"`
+		}
+		if err := types.Unmarshal(file.LinkDescriptor, &link); err != nil {
+			file.LinkDescriptor.Warnings = append(file.LinkDescriptor.Warnings, err.Error())
+		}
+		for _, path := range []string{link.FullPath, link.OriginalPath, link.RelativePath} {
+			if path != "" {
+				file.Path = path
+				break
+			}
+		}
+		if file.Version > 3 {
+			reader.Skip(4 + 4 + 8) // Modification date: year, month, day, hour, minute and seconds
+		}
+		size = reader.ReadInt64()
+		if file.Version == 2 && reader.Position+int(size) <= end { // Later versions don't embed the file
+			file.Data = reader.ReadBytes(int(size))
+		}
+	case "liFA":
+		reader.Skip(8)
+	}
+	if file.Version >= 5 {
+		file.ChildID = reader.ReadUnicodeString()
+	}
+	return file
+}
+
+// readRecordDescriptor reads descriptor which can't go beyond end of record.
+func readRecordDescriptor(end int) *types.Descriptor {
+	data := reader.Rest()
+	if length := end - reader.Position; length >= 0 && length < len(data) {
+		data = data[:length]
+	}
+	block := util.NewReader(data)
+	descriptor := types.NewDescriptor(block)
+	reader.Skip(block.Position)
+	return descriptor
+}
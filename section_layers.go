@@ -3,7 +3,6 @@ package gopsd
 import (
 	"fmt"
 	"image"
-	"image/color"
 	"math"
 
 	"github.com/solovev/gopsd/types"
@@ -27,7 +26,12 @@ func readLayers(doc *Document) {
 	}
 	lengthLayers = lengthLayers + 1 & ^0x01
 
-	layerCount := reader.ReadInt16()
+	globalAngle, globalAltitude := doc.globalLight()
+
+	var layerCount int16
+	if lengthLayers > 0 {
+		layerCount = reader.ReadInt16()
+	}
 	if layerCount < 0 {
 		// [TODO] First alpha channel contains the transparency data for the merged result.
 		layerCount = -layerCount
@@ -35,7 +39,11 @@ func readLayers(doc *Document) {
 
 	for i := 0; i < int(layerCount); i++ {
 		layer := new(Layer)
+		layer.document = doc
 		layer.Type = TypeUnspecified
+		layer.FillOpacity = 100
+		layer.BlendClippedElements = true
+		layer.TransparencyShapesLayer = true
 		layer.Rectangle = types.NewRectangle(reader)
 
 		chanCount := reader.ReadInt16()
@@ -77,6 +85,7 @@ func readLayers(doc *Document) {
 
 		// Mask data
 		size := reader.ReadInt32()
+		maskPos := reader.Position
 		if size != 0 {
 			layer.EnclosingMasks = append(layer.EnclosingMasks, types.NewRectangle(reader))
 			layer.DefaultColor = reader.ReadByte()
@@ -89,33 +98,19 @@ func readLayers(doc *Document) {
 				layer.EnclosingMasks = append(layer.EnclosingMasks, types.NewRectangle(reader))
 			}
 		}
+		reader.Skip(maskPos + int(size) - reader.Position) // Mask parameters
 
-		// Blending ranges
-		blendingLength := reader.ReadInt32()
-		layer.BlendingRanges = make([]*LayerBlendingRanges, blendingLength/8)
-		for i, value := range layer.BlendingRanges {
-			value = new(LayerBlendingRanges)
-			if i == 0 {
-				value.Name = "Gray"
-			} else {
-				value.Name = fmt.Sprintf("Channel%d", i-1)
-			}
-			value.SourceBlack = reader.ReadInt16()
-			value.SourceWhite = reader.ReadInt16()
-			value.DestBlack = reader.ReadInt16()
-			value.DestWhite = reader.ReadInt16()
-		}
+		layer.BlendingRanges = readBlendingRanges(reader)
 
 		// Name. Pascal string, padded to a multiple of 4 bytes
-		layer.Name = reader.ReadPascalString()
-		nameLength := len(layer.Name) + 1
-		if nameLength%4 != 0 {
-			skip := 4 - nameLength%4
-			reader.Skip(skip)
-		}
+		layer.legacyName = reader.ReadPaddedPascalString(4)
+		layer.Name = util.DecodeString(layer.legacyName, nil)
 
 		// Additional information at the end of the layer
 		index := 0
+		var shapeOrigins []*types.ShapeOrigin
+		var vectorContent *types.FillContent
+		var shapeStroke *types.ShapeStroke
 		for reader.Position < int(extraLength)+extraPos {
 			sign = reader.ReadString(4)
 			if sign != "8BIM" && sign != "8B64" {
@@ -124,22 +119,18 @@ func readLayers(doc *Document) {
 			key = reader.ReadString(4)
 			layer.DataKeys = append(layer.DataKeys, key)
 
-			var dataLength int64
-			if doc.IsLarge && util.StringValueIs(key, "LMsk", "Lr16", "Lr32", "Layr", "Mt16", "Mt32", "Mtrn", "Alph", "FMsk", "lnk2", "FEid", "FXid", "PxSD") {
-				dataLength = reader.ReadInt64()
-			} else {
-				dataLength = int64(reader.ReadInt32())
-			}
+			dataLength := readAdditionalLength(doc, key)
 			dataLength = dataLength + 1 & ^0x01
 			dataPos := reader.Position
 
 			switch key {
 			case "tySh":
-				layer.ObsoleteTypeTool = types.ReadObsoleteTypeTool(reader)
+				layer.ObsoleteTypeTool = types.ReadObsoleteTypeTool(reader, int(dataLength))
 			case "TySh":
-				layer.TypeTool = types.ReadTypeTool(reader)
+				layer.TypeTool = types.ReadTypeTool(readBlock(int(dataLength)), int(dataLength))
 			case "luni":
 				layer.Name = reader.ReadUnicodeString()
+				layer.unicodeName = true
 			case "lnsr": // layr / bgnd
 				switch reader.ReadString(4) {
 				case "layr":
@@ -164,6 +155,22 @@ func readLayers(doc *Document) {
 			case "knko":
 				layer.Knockout = reader.ReadByte() == 1
 				reader.Skip(3)
+			case "iOpa":
+				layer.FillOpacity = byte(math.Ceil(float64(reader.ReadByte()) / 255 * 100))
+				reader.Skip(3)
+			case "tsly":
+				layer.TransparencyShapesLayer = reader.ReadByte() == 1
+				reader.Skip(3)
+			case "lmgm":
+				layer.LayerMaskHidesEffects = reader.ReadByte() == 1
+				reader.Skip(3)
+			case "vmgm":
+				layer.VectorMaskHidesEffects = reader.ReadByte() == 1
+				reader.Skip(3)
+			case "brst":
+				for i := 0; i < int(dataLength)/4; i++ {
+					layer.RestrictedChannels = append(layer.RestrictedChannels, reader.ReadInt32())
+				}
 			case "lspf":
 				layer.ProtectionFlags = reader.ReadInt32()
 			case "lclr":
@@ -202,13 +209,27 @@ func readLayers(doc *Document) {
 			case "lrFX":
 				layer.ObsoleteEffects = types.ReadObsoleteEffects(reader)
 			case "lfx2":
-				reader.Skip(4) // Object based effects version (= 0)
-				reader.Skip(4) // Descriptor version (= 16)
-				layer.Effects = types.NewDescriptor(reader)
-			case "vogk": // TODO (Shape bounding box)
-				reader.Skip(4) // Version (= 1 for PS CC)
-				reader.Skip(4) // Descriptor version (= 16)
-				layer.VectorOriginData = types.NewDescriptor(reader)
+				if layer.Effects == nil {
+					layer.Effects = types.ReadLayerEffects(readBlock(int(dataLength)), globalAngle, globalAltitude)
+				}
+			case "lmfx": // Same as "lfx2", but contains multiple effects of one type
+				layer.Effects = types.ReadLayerEffects(readBlock(int(dataLength)), globalAngle, globalAltitude)
+			case "vogk":
+				layer.VectorOriginData, shapeOrigins = types.ReadShapeOrigins(readBlock(int(dataLength)))
+			case "SoCo", "GdFl", "PtFl":
+				layer.Fill = types.ReadFillContent(readBlock(int(dataLength)), key)
+			case "vscg":
+				vectorContent = types.ReadVectorContent(readBlock(int(dataLength)))
+			case "vstk":
+				shapeStroke = types.ReadShapeStroke(readBlock(int(dataLength)))
+			case "PlLd":
+				if layer.SmartObject == nil {
+					layer.SmartObject = types.ReadPlacedLayer(readBlock(int(dataLength)))
+				}
+			case "SoLd", "SoLE":
+				layer.SmartObject = types.ReadSmartObject(readBlock(int(dataLength)))
+			case "FEid", "FXid":
+				readFilterEffects(doc)
 			case "vmsk", "vsms":
 				reader.Skip(4) // Version (= 3 for PS 6.0)
 				flags := uint32(reader.ReadInt32())
@@ -226,41 +247,115 @@ func readLayers(doc *Document) {
 		}
 		// [CHECK] Not needed
 		reader.Skip(int(extraLength) - (reader.Position - extraPos))
+
+		if layer.Effects == nil && layer.ObsoleteEffects != nil {
+			layer.Effects = layer.ObsoleteEffects.LayerEffects(globalAngle)
+		}
+		if layer.Fill == nil {
+			layer.Fill = vectorContent
+		}
+		if layer.VectorMask != nil && (layer.Fill != nil || shapeStroke != nil) {
+			layer.Shape = &types.Shape{Path: layer.VectorMask.Path, Origins: shapeOrigins, Fill: layer.Fill, FillEnabled: true, Stroke: shapeStroke,
+				Inverted: layer.VectorMask.IsInverted}
+			if shapeStroke != nil {
+				layer.Shape.FillEnabled = shapeStroke.FillEnabled
+			}
+		}
 		doc.Layers = append(doc.Layers, layer)
 	}
 
 	for _, layer := range doc.Layers {
-		width := int(layer.Rectangle.Width)
-		height := int(layer.Rectangle.Height)
-
 		for _, channel := range layer.Channels {
+			rect := layer.channelRectangle(channel.ID)
+			width := int(rect.Width)
+			height := int(rect.Height)
+
 			compression := reader.ReadInt16()
-			switch compression {
-			case 0:
-				channel.Data = reader.ReadSignedBytes(width * height)
-			case 1:
-				var result []int8
-				scanLines := make([]int16, height)
-				for i := range scanLines {
-					scanLines[i] = reader.ReadInt16()
-				}
-				for i := range scanLines {
-					line := util.UnpackRLEBits(reader.ReadSignedBytes(scanLines[i]), width)
-					result = append(result, line...)
-				}
-				channel.Data = result
-			default:
+			data, ok := readChannelData(compression, width, height)
+			if !ok {
 				panic(fmt.Sprintf("[Layer: %s] Unknown compression method of channel [id: %d]", layer.Name, channel.ID))
 			}
+			channel.Data = data
 		}
 	}
+	layersEnd := pos + 4 + int(lengthLayers)
+	if doc.IsLarge {
+		layersEnd += 4
+	}
+	reader.Skip(layersEnd - reader.Position)
+	readGlobalInfo(doc, pos+int(length))
+
 	reader.Skip(int(length) - (reader.Position - pos))
 }
 
+// readChannelData reads pixels of channel compressed with specified method (0 = raw, 1 = RLE).
+// Returns false if method isn't supported.
+func readChannelData(compression int16, width, height int) ([]int8, bool) {
+	switch compression {
+	case 0:
+		return reader.ReadSignedBytes(width * height), true
+	case 1:
+		var result []int8
+		scanLines := make([]int16, height)
+		for i := range scanLines {
+			scanLines[i] = reader.ReadInt16()
+		}
+		for i := range scanLines {
+			line := util.UnpackRLEBits(reader.ReadSignedBytes(scanLines[i]), width)
+			result = append(result, line...)
+		}
+		return result, true
+	}
+	return nil, false
+}
+
+// readGlobalInfo reads global layer mask info and additional layer information, which follow layers.
+func readGlobalInfo(doc *Document, end int) {
+	if end-reader.Position < 4 {
+		return
+	}
+	reader.Skip(reader.ReadInt32()) // Global layer mask info
+
+	for end-reader.Position >= 12 {
+		sign := reader.ReadString(4)
+		if sign != "8BIM" && sign != "8B64" {
+			break
+		}
+		key := reader.ReadString(4)
+		dataLength := readAdditionalLength(doc, key)
+		dataPos := reader.Position
+
+		switch key {
+		case "Patt", "Pat2", "Pat3":
+			doc.Patterns = append(doc.Patterns, types.ReadPatterns(reader, int(dataLength))...)
+		case "lnk2", "lnkD", "lnk3", "lnkE":
+			readLinkedFiles(doc, dataPos+int(dataLength))
+		case "FEid", "FXid":
+			readFilterEffects(doc)
+		}
+		reader.Skip(dataPos + int((dataLength+3)&^0x03) - reader.Position)
+	}
+}
+
+// readAdditionalLength reads length of additional layer information. Some blocks have 8 bytes length in PSB.
+// readBlock reads data of block into separate reader, so descriptors in it can't read beyond the block.
+func readBlock(length int) *util.Reader {
+	return util.NewReader(reader.ReadBytes(length))
+}
+
+func readAdditionalLength(doc *Document, key string) int64 {
+	if doc.IsLarge && util.StringValueIs(key, "LMsk", "Lr16", "Lr32", "Layr", "Mt16", "Mt32", "Mtrn", "Alph", "FMsk", "lnk2", "FEid", "FXid", "PxSD") {
+		return reader.ReadInt64()
+	}
+	return int64(reader.ReadInt32())
+}
+
 func (l Layer) ToString() string {
 	return fmt.Sprintf("%s: %s", l.Name, l.Rectangle.ToString())
 }
 
+// Layer is a record of layer or group. Images of layer (GetImage, GetRenderedImage and Render methods)
+// have bounds in document coordinates, so they are drawn onto Document.Composite at their bounds.
 type Layer struct {
 	ID        int32
 	Name      string
@@ -278,11 +373,11 @@ type Layer struct {
 	MaskRealFlags  byte               `json:"-"`
 	MaskBackground byte               `json:"-"`
 
-	// [CHECK] Blending ranges data, empty name
+	// Blend If sliders. First entry is the composite gray channel, the rest follow the color channels
 	BlendingRanges []*LayerBlendingRanges `json:"-"`
 
 	Type                  LayerType    `json:"-"`
-	BlendClippedElements  bool         `json:"-"`
+	BlendClippedElements  bool         `json:"-"` // Blend clipped layers as group, true by default
 	BlendInteriorElements bool         `json:"-"`
 	Knockout              bool         `json:"-"`
 	ProtectionFlags       int32        `json:"-"`
@@ -293,51 +388,82 @@ type Layer struct {
 	IsSectionDivider      bool         `json:"-"`
 	DataKeys              []string
 
-	VectorMask       *LayerVectorMask  `json:"-"`
-	VectorOriginData *types.Descriptor `json:"-"`
+	// Advanced blending
+	FillOpacity             byte    `json:"-"` // Opacity of layer content, not affecting effects
+	TransparencyShapesLayer bool    `json:"-"` // Layer transparency defines shape of interior effects and blending
+	LayerMaskHidesEffects   bool    `json:"-"`
+	VectorMaskHidesEffects  bool    `json:"-"`
+	RestrictedChannels      []int32 `json:"-"` // Channels excluded from blending (0 = red, 1 = green, 2 = blue)
+
+	VectorMask       *LayerVectorMask   `json:"-"`
+	VectorOriginData *types.Descriptor  `json:"-"`
+	Fill             *types.FillContent `json:"-"` // Content of fill layer or fill of shape layer
+	Shape            *types.Shape       `json:"-"` // Vector shape of shape layer
+
+	SmartObject *types.SmartObject `json:"-"` // Placed content of smart object layer
 
 	ObsoleteTypeTool *types.ObsoleteTypeTool `json:"-"`
 	TypeTool         *types.TypeTool         `json:"-"`
 
+	// Effects are read from "lmfx" or "lfx2" and fall back to converted ObsoleteEffects ("lrFX")
 	ObsoleteEffects *types.ObsoleteEffects `json:"-"`
-	Effects         *types.Descriptor      `json:"-"`
+	Effects         *types.LayerEffects    `json:"-"`
 
 	TransparencyProtected, Visible, Obsolete, IrrelevantPixelData bool
 
 	Parent   *Layer
 	Children []*Layer
+
+	document    *Document
+	legacyName  string // Pascal string name as is
+	unicodeName bool
 }
 
 func (l *Layer) IsText() bool {
 	return l.ObsoleteTypeTool != nil || l.TypeTool != nil
 }
 
-func (l *Layer) GetImage() (image.Image, error) {
-	width := int(l.Rectangle.Width)
-	height := int(l.Rectangle.Height)
+// Text returns content of text layer with its character and paragraph styles, nil for other layers.
+func (l *Layer) Text() *types.Text {
+	switch {
+	case l.TypeTool != nil:
+		return l.TypeTool.Text()
+	case l.ObsoleteTypeTool != nil:
+		return l.ObsoleteTypeTool.Text()
+	}
+	return nil
+}
 
-	if width == 0 || height == 0 {
+// GetImage returns pixels of layer channels with enabled vector mask applied, user mask is applied
+// by GetRenderedImage. Image has bounds of layer's rectangle.
+func (l *Layer) GetImage() (image.Image, error) {
+	content := l.content()
+	if content == nil {
 		return nil, nil
 	}
+	l.applyVectorMask(content)
+	return content.image(), nil
+}
 
-	image := image.NewRGBA(image.Rect(0, 0, width, height))
-	switch len(l.Channels) {
-	case 3: // RGB
-		// [TODO]
-	case 4, 5:
-		c := l.Channels
-		for x := 0; x < width; x++ {
-			for y := 0; y < height; y++ {
-				i := x + (y * width)
-				red := byte(c[1].Data[i])
-				green := byte(c[2].Data[i])
-				blue := byte(c[3].Data[i])
-				alpha := byte(c[0].Data[i])
-				image.Set(x, y, color.RGBA{red, green, blue, alpha})
-			}
+// GetChannel returns channel with specified ID or nil if layer doesn't have it.
+func (l *Layer) GetChannel(id int16) *LayerChannel {
+	for _, channel := range l.Channels {
+		if channel.ID == id {
+			return channel
 		}
 	}
-	return image, nil
+	return nil
+}
+
+// channelRectangle returns bounds of channel data. Mask channels have their own bounds.
+func (l *Layer) channelRectangle(id int16) *types.Rectangle {
+	switch {
+	case id == -2 && len(l.EnclosingMasks) > 0:
+		return l.EnclosingMasks[0]
+	case id == -3 && len(l.EnclosingMasks) > 1:
+		return l.EnclosingMasks[1]
+	}
+	return l.Rectangle
 }
 
 type LayerVectorMask struct {
@@ -345,6 +471,17 @@ type LayerVectorMask struct {
 	Path                             *types.Path
 }
 
+// Rasterize returns anti-aliased mask of path, inverted if the mask is. Bounds are in pixels of document multiplied by scale.
+func (m *LayerVectorMask) Rasterize(bounds image.Rectangle, scale float64) *image.Alpha {
+	alpha := m.Path.Rasterize(bounds, scale)
+	if m.IsInverted {
+		for i, value := range alpha.Pix {
+			alpha.Pix[i] = 255 - value
+		}
+	}
+	return alpha
+}
+
 // LayerChannel stores color data of channel.
 // Channel IDs:
 //		0 = red, 1 = green, 2 = blue;
@@ -358,12 +495,61 @@ type LayerChannel struct {
 	Data   []int8
 }
 
+// LayerBlendingRanges stores "Blend If" sliders of one channel
+// for the current layer (Source) and the underlying layers (Dest).
 type LayerBlendingRanges struct {
-	Name        string
-	SourceBlack int16
-	SourceWhite int16
-	DestBlack   int16
-	DestWhite   int16
+	Name         string
+	Source, Dest *BlendingRange
+}
+
+// BlendingRange stores black and white points of a "Blend If" slider.
+// Each point may be split (Alt+drag in Photoshop) into Low and High values,
+// the layer fades in/out between them. Unsplit points have Low == High.
+type BlendingRange struct {
+	BlackLow, BlackHigh byte
+	WhiteLow, WhiteHigh byte
+}
+
+// readBlendingRanges reads "Blend If" sliders: composite gray channel followed by color channels.
+func readBlendingRanges(reader *util.Reader) []*LayerBlendingRanges {
+	length := reader.ReadInt32()
+	ranges := make([]*LayerBlendingRanges, length/8)
+	for i := range ranges {
+		channel := new(LayerBlendingRanges)
+		if i == 0 {
+			channel.Name = "Gray"
+		} else {
+			channel.Name = fmt.Sprintf("Channel%d", i-1)
+		}
+		channel.Source = readBlendingRange(reader)
+		channel.Dest = readBlendingRange(reader)
+		ranges[i] = channel
+	}
+	reader.Skip(int(length) % 8)
+	return ranges
+}
+
+func readBlendingRange(reader *util.Reader) *BlendingRange {
+	return &BlendingRange{reader.ReadByte(), reader.ReadByte(), reader.ReadByte(), reader.ReadByte()}
+}
+
+// IsDefault reports whether the range passes every value (0-255 without splits).
+func (r *BlendingRange) IsDefault() bool {
+	return r.BlackLow == 0 && r.BlackHigh == 0 && r.WhiteLow == 255 && r.WhiteHigh == 255
+}
+
+// Weight returns visibility of value in range [0, 1].
+func (r *BlendingRange) Weight(value float64) float64 {
+	value *= 255
+	switch {
+	case value < float64(r.BlackLow) || value > float64(r.WhiteHigh):
+		return 0
+	case value < float64(r.BlackHigh):
+		return (value - float64(r.BlackLow)) / float64(r.BlackHigh-r.BlackLow)
+	case value > float64(r.WhiteLow):
+		return (float64(r.WhiteHigh) - value) / float64(r.WhiteHigh-r.WhiteLow)
+	}
+	return 1
 }
 
 // [TODO] Not impl yet
@@ -0,0 +1,77 @@
+package gopsd
+
+import (
+	"testing"
+
+	"github.com/solovev/gopsd/util"
+)
+
+func TestReadBlendingRanges(t *testing.T) {
+	data := []byte{
+		0, 0, 0, 19, // Length: two channels and three bytes of padding
+		0, 10, 200, 255, 5, 5, 250, 250, // Gray: split black point of source
+		20, 20, 128, 160, 0, 0, 255, 255, // Red: split white point of source
+		1, 2, 3,
+		0xAB, // Next field
+	}
+	reader := util.NewReader(data)
+	ranges := readBlendingRanges(reader)
+	if len(ranges) != 2 {
+		t.Fatalf("got %d ranges, want 2", len(ranges))
+	}
+	if reader.Position != len(data)-1 {
+		t.Errorf("position %d, want %d", reader.Position, len(data)-1)
+	}
+	want := []LayerBlendingRanges{
+		{"Gray", &BlendingRange{0, 10, 200, 255}, &BlendingRange{5, 5, 250, 250}},
+		{"Channel0", &BlendingRange{20, 20, 128, 160}, &BlendingRange{0, 0, 255, 255}},
+	}
+	for i, w := range want {
+		got := ranges[i]
+		if got.Name != w.Name || *got.Source != *w.Source || *got.Dest != *w.Dest {
+			t.Errorf("range %d: got %s %v %v, want %s %v %v", i, got.Name, *got.Source, *got.Dest, w.Name, *w.Source, *w.Dest)
+		}
+	}
+	if !ranges[1].Dest.IsDefault() || ranges[0].Dest.IsDefault() {
+		t.Error("IsDefault is wrong")
+	}
+}
+
+func TestBlendingRangeWeight(t *testing.T) {
+	r := &BlendingRange{BlackLow: 0, BlackHigh: 100, WhiteLow: 200, WhiteHigh: 240}
+	tests := []struct {
+		value, want float64
+	}{
+		{0, 0},
+		{50, 0.5},
+		{150, 1},
+		{220, 0.5},
+		{250, 0},
+	}
+	for _, test := range tests {
+		if got := r.Weight(test.value / 255); got < test.want-1e-9 || got > test.want+1e-9 {
+			t.Errorf("Weight(%v) = %v, want %v", test.value, got, test.want)
+		}
+	}
+}
+
+func TestReadLayersWithoutLayers(t *testing.T) {
+	data := []byte{
+		0, 0, 0, 24, // Length of layer and mask information
+		0, 0, 0, 0, // Length of layers info
+		0, 0, 0, 4, 0, 0, 0, 0, // Global layer mask info
+		'8', 'B', 'I', 'M', 'l', 'n', 'k', '2', 0, 0, 0, 0, // Empty linked files
+	}
+	reader = util.NewReader(data)
+	doc := new(Document)
+	readLayers(doc)
+	if len(doc.Layers) != 0 {
+		t.Errorf("got %d layers, want 0", len(doc.Layers))
+	}
+	if doc.LinkedFiles == nil {
+		t.Error("global additional information isn't read")
+	}
+	if reader.Position != len(data) {
+		t.Errorf("position %d, want %d", reader.Position, len(data))
+	}
+}
@@ -26,6 +26,36 @@ type IRAspectRatio struct {
 	Ratio   float64
 }
 
+// IRResolution is resolution in pixels per inch. Units are only used for display:
+// 1 = pixels per inch, 2 = pixels per cm; 1 = inches, 2 = cm, 3 = points, 4 = picas, 5 = columns.
+type IRResolution struct {
+	HorizontalResolution, VerticalResolution float64
+	HorizontalUnit, VerticalUnit             int16
+	WidthUnit, HeightUnit                    int16
+}
+
+// IRPath is a path saved in document (image resources 2000-2997). Name is name of resource.
+type IRPath struct {
+	ID   int16
+	Name string
+	Path *types.Path
+}
+
+// IRClippingPath names saved path used as clipping path (image resource 2999).
+// Flatness is in device pixels, 0 means default of output device.
+type IRClippingPath struct {
+	Name     string
+	Flatness float64
+
+	legacyName string
+}
+
+// IROriginPathInfo stores live shape origins of paths (image resource 3000).
+type IROriginPathInfo struct {
+	Descriptor *types.Descriptor
+	Origins    []*types.ShapeOrigin
+}
+
 // http://www.adobe.com/devnet-apps/photoshop/fileformatashtml/#50577409_74450
 func ReadResourceThumbnail(reader *util.Reader) *IRThumbnail {
 	thumb := new(IRThumbnail)
@@ -66,6 +96,37 @@ func ReadResourcePrintStyle(reader *util.Reader) *IRPrintStyle {
 	return style
 }
 
+func ReadResourceResolution(reader *util.Reader) *IRResolution {
+	resolution := new(IRResolution)
+
+	resolution.HorizontalResolution = float64(reader.ReadInt32()) / 65536
+	resolution.HorizontalUnit = reader.ReadInt16()
+	resolution.WidthUnit = reader.ReadInt16()
+	resolution.VerticalResolution = float64(reader.ReadInt32()) / 65536
+	resolution.VerticalUnit = reader.ReadInt16()
+	resolution.HeightUnit = reader.ReadInt16()
+
+	return resolution
+}
+
+func ReadResourceClippingPath(reader *util.Reader, size int) *IRClippingPath {
+	clipping := new(IRClippingPath)
+	start := reader.Position
+	clipping.legacyName = reader.ReadPascalString()
+	if start+size-reader.Position >= 2 {
+		clipping.Flatness = float64(reader.ReadInt16()) / 256 // 8.8 fixed point
+	}
+	return clipping
+}
+
+func ReadResourceOriginPathInfo(reader *util.Reader) *IROriginPathInfo {
+	info := new(IROriginPathInfo)
+	reader.Skip(4) // Descriptor version (= 16)
+	info.Descriptor = types.NewDescriptor(reader)
+	info.Origins = types.NewShapeOrigins(info.Descriptor)
+	return info
+}
+
 // TODO
 func ReadResourceAspectRatio(reader *util.Reader) *IRAspectRatio {
 	ratio := new(IRAspectRatio)
@@ -80,6 +141,8 @@ func readResources(doc *Document) {
 	length := reader.ReadInt32()
 
 	doc.Resources = make(map[int16]interface{})
+	doc.ResourceNames = make(map[int16]string)
+	doc.legacyResourceNames = make(map[int16]string)
 	startPos := 0
 
 	for startPos < int(length) {
@@ -91,8 +154,11 @@ func readResources(doc *Document) {
 		}
 
 		id := reader.ReadInt16()
-		// Resource name [CHECK]
-		reader.ReadPascalString()
+		// Name, padded to even size
+		if name := reader.ReadPaddedPascalString(2); name != "" {
+			doc.ResourceNames[id] = name
+			doc.legacyResourceNames[id] = name
+		}
 
 		size := reader.ReadInt32()
 		dataPos := reader.Position
@@ -100,11 +166,25 @@ func readResources(doc *Document) {
 		switch id {
 		case 1033, 1036:
 			doc.Resources[id] = ReadResourceThumbnail(reader)
+		case 1005:
+			doc.Resources[id] = ReadResourceResolution(reader)
 		case 1083:
-			doc.Resources[id] = ReadResourcePrintStyle(reader)
+			doc.Resources[id] = ReadResourcePrintStyle(readBlock(int(size)))
 		case 1064:
 			doc.Resources[id] = ReadResourceAspectRatio(reader)
+		case 1037, 1049: // Global angle, global altitude
+			doc.Resources[id] = reader.ReadInt32()
+		case 2999:
+			doc.Resources[id] = ReadResourceClippingPath(reader, int(size))
+		case 3000:
+			doc.Resources[id] = ReadResourceOriginPathInfo(readBlock(int(size)))
 		default:
+			if id >= 2000 && id <= 2997 {
+				path := &IRPath{ID: id, Path: types.ReadPath(doc.Width, doc.Height, reader.ReadBytes(size))}
+				doc.Resources[id] = path
+				doc.Paths = append(doc.Paths, path)
+				break
+			}
 			doc.Resources[id] = nil
 		}
 		if size%2 != 0 {
@@ -115,3 +195,38 @@ func readResources(doc *Document) {
 		startPos += reader.Position - pos
 	}
 }
+
+// Resolution returns vertical resolution of document in pixels per inch, 72 if it isn't specified.
+func (d *Document) Resolution() float64 {
+	if value, ok := d.Resources[1005].(*IRResolution); ok && value.VerticalResolution > 0 {
+		return value.VerticalResolution
+	}
+	return 72
+}
+
+// ClippingPath returns saved path used as clipping path of document (e.g. when it is placed
+// into layout) and its flatness, nil if there is no clipping path.
+func (d *Document) ClippingPath() (*IRPath, float64) {
+	clipping, ok := d.Resources[2999].(*IRClippingPath)
+	if !ok {
+		return nil, 0
+	}
+	for _, path := range d.Paths {
+		if path.Name == clipping.Name {
+			return path, clipping.Flatness
+		}
+	}
+	return nil, 0
+}
+
+// globalLight returns angle and altitude (degrees) shared by effects with "Use global light" set.
+func (d *Document) globalLight() (angle, altitude float64) {
+	angle, altitude = 120, 30
+	if value, ok := d.Resources[1037].(int32); ok {
+		angle = float64(value)
+	}
+	if value, ok := d.Resources[1049].(int32); ok {
+		altitude = float64(value)
+	}
+	return angle, altitude
+}
@@ -0,0 +1,90 @@
+package gopsd
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/solovev/gopsd/types"
+)
+
+// RenderShape renders fill and stroke of shape layer from its path with coordinates multiplied by scale,
+// so it stays sharp at any zoom. Bounds of image are in pixels of document multiplied by scale.
+// Inverted shape is filled over the whole document except its path.
+// Opacity, blend mode, masks and effects of layer aren't applied.
+func (l *Layer) RenderShape(scale float64) (image.Image, error) {
+	shape := l.Shape
+	if shape == nil || shape.Path == nil {
+		return nil, fmt.Errorf("Layer \"%s\" is not a shape layer", l.Name)
+	}
+	if scale <= 0 {
+		return nil, fmt.Errorf("Wrong scale %v", scale)
+	}
+	bounds := shape.Path.Extent(scale)
+	if shape.Inverted && l.document != nil {
+		// Inverted shape covers the whole document except its path
+		bounds = image.Rect(0, 0, int(math.Round(float64(l.document.Width)*scale)), int(math.Round(float64(l.document.Height)*scale)))
+	}
+	stroke := shape.Stroke
+	if stroke != nil && (!stroke.Enabled || stroke.Width <= 0) {
+		stroke = nil
+	}
+	rect := bounds
+	if stroke != nil {
+		rect = rect.Union(shape.Path.StrokeExtent(scale, stroke))
+	}
+
+	result := newBitmap(rect)
+	if shape.FillEnabled && shape.Fill != nil {
+		fill := l.fillShape(shape.RasterizeFill(rect, scale), shape.Fill, bounds, scale)
+		blendBitmaps(result, fill, blending{mode: "Normal", opacity: 1})
+	}
+	if stroke != nil {
+		content := stroke.Content
+		if content == nil {
+			content = &types.FillContent{Type: "Color", Color: color.NRGBA{0, 0, 0, 255}}
+		}
+		fill := l.fillShape(shape.RasterizeStroke(rect, scale, stroke), content, bounds, scale)
+		blendBitmaps(result, fill, blending{mode: stroke.BlendMode, opacity: stroke.Opacity / 100})
+	}
+	return result.image(), nil
+}
+
+// fillShape fills anti-aliased mask with content placed over bounds of shape.
+func (l *Layer) fillShape(mask *image.Alpha, content *types.FillContent, bounds image.Rectangle, scale float64) *bitmap {
+	colors := l.contentColor(content, bounds, scale)
+	b := newBitmap(mask.Rect)
+	for y := mask.Rect.Min.Y; y < mask.Rect.Max.Y; y++ {
+		for x := mask.Rect.Min.X; x < mask.Rect.Max.X; x++ {
+			a := float64(mask.AlphaAt(x, y).A) / 255
+			if a <= 0 {
+				continue
+			}
+			c, ca := colors(x, y)
+			b.set(x, y, c, a*ca)
+		}
+	}
+	return b
+}
+
+// contentColor returns colors of fill content at pixels of document multiplied by scale.
+func (l *Layer) contentColor(content *types.FillContent, bounds image.Rectangle, scale float64) colorFunc {
+	switch {
+	case content.Type == "Gradient" && content.Gradient != nil:
+		fill := content.Gradient
+		if !fill.AlignWithLayer && l.document != nil {
+			bounds = image.Rect(0, 0, int(math.Round(float64(l.document.Width)*scale)), int(math.Round(float64(l.document.Height)*scale)))
+		}
+		return func(x, y int) ([3]float64, float64) {
+			return gradientColor(fill.Gradient, gradientPosition(fill, bounds, float64(x)+0.5, float64(y)+0.5))
+		}
+	case content.Type == "Pattern" && content.Pattern != nil:
+		fill := *content.Pattern
+		fill.Scale *= scale
+		fill.PhaseX *= scale
+		fill.PhaseY *= scale
+		return (&effectRenderer{layer: l, bounds: bounds}).patternColor(&fill)
+	}
+	return solidColor(content.Color)
+}
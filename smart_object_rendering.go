@@ -0,0 +1,408 @@
+package gopsd
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/solovev/gopsd/types"
+)
+
+// meshSteps is number of cells of tessellation along each side of warp patch.
+const meshSteps = 16
+
+// RenderSmartObject renders content of smart object layer in document coordinates: source is stretched
+// over rectangle of placed content, warped by its mesh and mapped onto quad of its transform.
+// Nil source renders embedded or linked file (composite image of PSD and PSB documents).
+// Standard warp styles without mesh aren't supported, such content is rendered unwarped (see Warnings).
+// Resampling is "Nearest neighbor", "Bilinear" or "Bicubic".
+// Opacity, blend mode, masks, effects and smart filters of layer aren't applied.
+func (l *Layer) RenderSmartObject(source image.Image, resampling string) (image.Image, error) {
+	so := l.SmartObject
+	if so == nil {
+		return nil, fmt.Errorf("Layer \"%s\" is not a smart object", l.Name)
+	}
+	if resampling != "Nearest neighbor" && resampling != "Bilinear" && resampling != "Bicubic" {
+		return nil, fmt.Errorf("Unknown resampling \"%s\"", resampling)
+	}
+	if source == nil {
+		var err error
+		if source, err = l.smartObjectSource(); err != nil {
+			return nil, err
+		}
+	}
+	if source.Bounds().Empty() {
+		return nil, fmt.Errorf("Source of layer \"%s\" is empty", l.Name)
+	}
+	mesh, err := newWarpMesh(so, source.Bounds())
+	if err != nil {
+		return nil, err
+	}
+
+	q := so.NonAffineTransform
+	s := newSampler(source)
+	for quadArea(q) < float64(s.width*s.height)/4 && s.width > 1 && s.height > 1 {
+		s = s.half() // Reduces aliasing of downscaled content
+	}
+	if resampling == "Nearest neighbor" {
+		s.margin = 0
+	}
+	h := newHomography(q)
+	vertices, columns := mesh.tessellate(h, s.margin/float64(s.width), s.margin/float64(s.height))
+
+	rect := image.Rectangle{}
+	for _, v := range vertices {
+		if math.IsNaN(v.x) {
+			continue
+		}
+		r := image.Rect(int(math.Floor(v.x)), int(math.Floor(v.y)), int(math.Ceil(v.x))+1, int(math.Ceil(v.y))+1)
+		rect = rect.Union(r)
+	}
+	result := newBitmap(rect)
+	for i := 0; i+columns+1 < len(vertices); i++ {
+		if (i+1)%columns == 0 {
+			continue
+		}
+		a, b, c, d := vertices[i], vertices[i+1], vertices[i+columns+1], vertices[i+columns]
+		for _, triangle := range [][3]meshVertex{{a, b, c}, {a, c, d}} {
+			drawTriangle(result, triangle, func(u, v float64) [4]float64 {
+				return s.sample(u, v, resampling)
+			})
+		}
+	}
+	return result.image(), nil
+}
+
+// smartObjectSource decodes file placed into smart object.
+func (l *Layer) smartObjectSource() (image.Image, error) {
+	var file *LinkedFile
+	if l.document != nil {
+		file = l.document.LinkedFiles[l.SmartObject.ID]
+	}
+	if file == nil || len(file.Data) == 0 {
+		return nil, fmt.Errorf("Data of smart object \"%s\" isn't found", l.Name)
+	}
+	if file.IsDocument() {
+		doc, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		if doc.Image != nil {
+			return doc.Image, nil
+		}
+		return doc.Composite()
+	}
+	// Only formats registered in image package can be decoded
+	img, _, err := image.Decode(bytes.NewReader(file.Data))
+	if err != nil {
+		return nil, fmt.Errorf("Can't decode file \"%s\" of smart object \"%s\": %v", file.Name, l.Name, err)
+	}
+	return img, nil
+}
+
+func quadArea(q [8]float64) float64 {
+	area := 0.0
+	for i := 0; i < 4; i++ {
+		j := (i + 1) % 4
+		area += q[2*i]*q[2*j+1] - q[2*j]*q[2*i+1]
+	}
+	return math.Abs(area) / 2
+}
+
+// homography is projective transformation of unit square onto quad (top left, top right,
+// bottom right and bottom left corners): x = (a*u + b*v + c) / w, y = (d*u + e*v + f) / w, w = g*u + h*v + 1.
+type homography struct {
+	a, b, c, d, e, f, g, h float64
+}
+
+func newHomography(q [8]float64) *homography {
+	x0, y0, x1, y1, x2, y2, x3, y3 := q[0], q[1], q[2], q[3], q[4], q[5], q[6], q[7]
+	m := new(homography)
+	dx1, dx2, dx3 := x1-x2, x3-x2, x0-x1+x2-x3
+	dy1, dy2, dy3 := y1-y2, y3-y2, y0-y1+y2-y3
+	if det := dx1*dy2 - dx2*dy1; det != 0 && (math.Abs(dx3) > 1e-9 || math.Abs(dy3) > 1e-9) {
+		m.g = (dx3*dy2 - dx2*dy3) / det
+		m.h = (dx1*dy3 - dx3*dy1) / det
+	}
+	m.a, m.b, m.c = x1-x0+m.g*x1, x3-x0+m.h*x3, x0
+	m.d, m.e, m.f = y1-y0+m.g*y1, y3-y0+m.h*y3, y0
+	return m
+}
+
+// meshVertex is vertex of tessellated content in document coordinates with perspective-correct
+// attributes: position (u, v) in source divided by w, and 1 / w.
+type meshVertex struct {
+	x, y, u, v, w float64
+}
+
+func (m *homography) vertex(x, y, u, v float64) meshVertex {
+	w := m.g*x + m.h*y + 1
+	if w <= 0 {
+		return meshVertex{math.NaN(), math.NaN(), 0, 0, 0}
+	}
+	return meshVertex{(m.a*x + m.b*y + m.c) / w, (m.d*x + m.e*y + m.f) / w, u / w, v / w, 1 / w}
+}
+
+// warpMesh is grid of bicubic Bézier patches, which maps source onto placed content.
+// Coordinates are relative to rectangle of content, (0, 0) is top left and (1, 1) is bottom right corner.
+type warpMesh struct {
+	points        []types.PointFloat // Nil if content isn't warped
+	width, height int                // Number of points in row and column
+	slicesX       []float64          // Edges of patches
+	slicesY       []float64
+}
+
+func newWarpMesh(so *types.SmartObject, bounds image.Rectangle) (*warpMesh, error) {
+	mesh := &warpMesh{slicesX: []float64{0, 1}, slicesY: []float64{0, 1}}
+	warp := so.Warp
+	if warp == nil || warp.Style == "" || warp.Style == "None" {
+		return mesh, nil
+	}
+	if len(warp.Mesh) == 0 {
+		return mesh, nil // Standard style without mesh, see Warnings of smart object
+	}
+
+	rect := types.RectangleFloat{Right: so.Width, Bottom: so.Height}
+	if warp.Bounds != nil {
+		rect = *warp.Bounds
+	}
+	if rect.Right <= rect.Left || rect.Bottom <= rect.Top {
+		rect = types.RectangleFloat{Right: float64(bounds.Dx()), Bottom: float64(bounds.Dy())}
+	}
+	w, h := rect.Right-rect.Left, rect.Bottom-rect.Top
+
+	mesh.width, mesh.height = warp.UOrder, warp.VOrder
+	if len(warp.SliceX) > 1 && len(warp.SliceY) > 1 { // Quilt warp
+		mesh.width, mesh.height = 3*len(warp.SliceX)-2, 3*len(warp.SliceY)-2
+		mesh.slicesX, mesh.slicesY = nil, nil
+		for _, x := range warp.SliceX {
+			mesh.slicesX = append(mesh.slicesX, (x-rect.Left)/w)
+		}
+		for _, y := range warp.SliceY {
+			mesh.slicesY = append(mesh.slicesY, (y-rect.Top)/h)
+		}
+	} else {
+		if mesh.width == 0 || mesh.height == 0 {
+			mesh.width, mesh.height = 4, 4
+		}
+		mesh.slicesX, mesh.slicesY = uniformSlices((mesh.width-1)/3), uniformSlices((mesh.height-1)/3)
+	}
+	if (mesh.width-1)%3 != 0 || (mesh.height-1)%3 != 0 || mesh.width < 4 || mesh.height < 4 {
+		return nil, fmt.Errorf("Wrong size of warp mesh %dx%d", mesh.width, mesh.height)
+	}
+	if len(warp.Mesh) != mesh.width*mesh.height {
+		return nil, fmt.Errorf("Warp mesh has %d points, expected %d", len(warp.Mesh), mesh.width*mesh.height)
+	}
+	for _, point := range warp.Mesh {
+		mesh.points = append(mesh.points, types.PointFloat{X: (point.X - rect.Left) / w, Y: (point.Y - rect.Top) / h})
+	}
+	return mesh, nil
+}
+
+func uniformSlices(n int) []float64 {
+	slices := make([]float64, n+1)
+	for i := range slices {
+		slices[i] = float64(i) / float64(n)
+	}
+	return slices
+}
+
+// tessellate maps grid over source (extended by margins) onto document and returns
+// its vertices row by row and number of vertices in row.
+func (m *warpMesh) tessellate(h *homography, marginX, marginY float64) ([]meshVertex, int) {
+	steps := 1
+	if m.points != nil {
+		steps = meshSteps
+	}
+	us, vs := gridLines(m.slicesX, steps, marginX), gridLines(m.slicesY, steps, marginY)
+	vertices := make([]meshVertex, 0, len(us)*len(vs))
+	for _, v := range vs {
+		for _, u := range us {
+			x, y := m.at(u, v)
+			vertices = append(vertices, h.vertex(x, y, u, v))
+		}
+	}
+	return vertices, len(us)
+}
+
+// gridLines splits every slice into steps and adds margins before the first and after the last one.
+func gridLines(slices []float64, steps int, margin float64) []float64 {
+	lines := []float64{slices[0] - margin}
+	for i := 0; i+1 < len(slices); i++ {
+		for j := 0; j < steps; j++ {
+			lines = append(lines, slices[i]+(slices[i+1]-slices[i])*float64(j)/float64(steps))
+		}
+	}
+	return append(lines, slices[len(slices)-1], slices[len(slices)-1]+margin)
+}
+
+// at returns position of source point (u, v) in content after warp.
+func (m *warpMesh) at(u, v float64) (float64, float64) {
+	if m.points == nil {
+		return u, v
+	}
+	i, s := patchPosition(m.slicesX, u)
+	j, t := patchPosition(m.slicesY, v)
+	bu, bv := bernstein(s), bernstein(t)
+	var x, y float64
+	for row := 0; row < 4; row++ {
+		for column := 0; column < 4; column++ {
+			point := m.points[(3*j+row)*m.width+3*i+column]
+			k := bv[row] * bu[column]
+			x += k * point.X
+			y += k * point.Y
+		}
+	}
+	return x, y
+}
+
+// patchPosition returns index of patch containing position and position within patch.
+// Positions outside of mesh are extrapolated from the border patches.
+func patchPosition(slices []float64, position float64) (int, float64) {
+	i := 0
+	for i < len(slices)-2 && position >= slices[i+1] {
+		i++
+	}
+	size := slices[i+1] - slices[i]
+	if size == 0 {
+		return i, 0
+	}
+	return i, (position - slices[i]) / size
+}
+
+// bernstein returns cubic Bernstein polynomials at t.
+func bernstein(t float64) [4]float64 {
+	s := 1 - t
+	return [4]float64{s * s * s, 3 * s * s * t, 3 * s * t * t, t * t * t}
+}
+
+// drawTriangle sets pixels of dst, which centers are inside of triangle, to colors (premultiplied)
+// of source at perspective-correct interpolated positions.
+func drawTriangle(dst *bitmap, t [3]meshVertex, source func(u, v float64) [4]float64) {
+	a, b, c := t[0], t[1], t[2]
+	area := (b.x-a.x)*(c.y-a.y) - (b.y-a.y)*(c.x-a.x)
+	if area == 0 || math.IsNaN(area) {
+		return
+	}
+	rect := image.Rect(int(math.Floor(math.Min(a.x, math.Min(b.x, c.x)))), int(math.Floor(math.Min(a.y, math.Min(b.y, c.y)))),
+		int(math.Ceil(math.Max(a.x, math.Max(b.x, c.x)))), int(math.Ceil(math.Max(a.y, math.Max(b.y, c.y))))).Intersect(dst.Rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		py := float64(y) + 0.5
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			px := float64(x) + 0.5
+			la := ((b.x-px)*(c.y-py) - (b.y-py)*(c.x-px)) / area
+			lb := ((c.x-px)*(a.y-py) - (c.y-py)*(a.x-px)) / area
+			lc := 1 - la - lb
+			if la < 0 || lb < 0 || lc < 0 {
+				continue
+			}
+			w := la*a.w + lb*b.w + lc*c.w
+			color := source((la*a.u+lb*b.u+lc*c.u)/w, (la*a.v+lb*b.v+lc*c.v)/w)
+			if color[3] <= 0 {
+				continue
+			}
+			dst.set(x, y, [3]float64{color[0] / color[3], color[1] / color[3], color[2] / color[3]}, color[3])
+		}
+	}
+}
+
+// sampler reads premultiplied pixels of source image, which is transparent outside of its bounds.
+type sampler struct {
+	width, height int
+	pix           []float64
+	margin        float64 // Transparent border (in pixels), which anti-aliases edges of content
+}
+
+func newSampler(img image.Image) *sampler {
+	bounds := img.Bounds()
+	s := &sampler{width: bounds.Dx(), height: bounds.Dy(), margin: 1}
+	s.pix = make([]float64, 4*s.width*s.height)
+	i := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			s.pix[i], s.pix[i+1], s.pix[i+2], s.pix[i+3] = float64(r)/0xffff, float64(g)/0xffff, float64(b)/0xffff, float64(a)/0xffff
+			i += 4
+		}
+	}
+	return s
+}
+
+// half returns source downscaled twice by averaging blocks of 2x2 pixels.
+func (s *sampler) half() *sampler {
+	h := &sampler{width: (s.width + 1) / 2, height: (s.height + 1) / 2, margin: s.margin}
+	h.pix = make([]float64, 4*h.width*h.height)
+	for y := 0; y < h.height; y++ {
+		for x := 0; x < h.width; x++ {
+			var sum [4]float64
+			n := 0.0
+			for dy := 0; dy < 2 && 2*y+dy < s.height; dy++ {
+				for dx := 0; dx < 2 && 2*x+dx < s.width; dx++ {
+					i := 4 * ((2*y+dy)*s.width + 2*x + dx)
+					for k := range sum {
+						sum[k] += s.pix[i+k]
+					}
+					n++
+				}
+			}
+			i := 4 * (y*h.width + x)
+			for k := range sum {
+				h.pix[i+k] = sum[k] / n
+			}
+		}
+	}
+	return h
+}
+
+func (s *sampler) pixel(x, y int) [4]float64 {
+	if x < 0 || y < 0 || x >= s.width || y >= s.height {
+		return [4]float64{}
+	}
+	i := 4 * (y*s.width + x)
+	return [4]float64{s.pix[i], s.pix[i+1], s.pix[i+2], s.pix[i+3]}
+}
+
+// sample returns color at position (u, v), relative to size of source.
+func (s *sampler) sample(u, v float64, resampling string) [4]float64 {
+	x, y := u*float64(s.width), v*float64(s.height)
+	if resampling == "Nearest neighbor" {
+		return s.pixel(int(math.Floor(x)), int(math.Floor(y)))
+	}
+	x, y = x-0.5, y-0.5 // Centers of pixels
+	x0, y0 := math.Floor(x), math.Floor(y)
+	fx, fy := x-x0, y-y0
+
+	var wx, wy []float64
+	var start int
+	if resampling == "Bicubic" {
+		wx, wy, start = cubicWeights(fx), cubicWeights(fy), -1
+	} else {
+		wx, wy = []float64{1 - fx, fx}, []float64{1 - fy, fy}
+	}
+	var result [4]float64
+	for j, ky := range wy {
+		for i, kx := range wx {
+			p := s.pixel(int(x0)+start+i, int(y0)+start+j)
+			for k := range result {
+				result[k] += kx * ky * p[k]
+			}
+		}
+	}
+	result[3] = clamp(result[3])
+	for k := 0; k < 3; k++ {
+		result[k] = math.Max(0, math.Min(result[3], result[k]))
+	}
+	return result
+}
+
+// cubicWeights returns weights of Catmull-Rom spline for 4 pixels around position t in [0, 1).
+func cubicWeights(t float64) []float64 {
+	t2, t3 := t*t, t*t*t
+	return []float64{
+		(-t3 + 2*t2 - t) / 2,
+		(3*t3 - 5*t2 + 2) / 2,
+		(-3*t3 + 4*t2 + t) / 2,
+		(t3 - t2) / 2,
+	}
+}
@@ -0,0 +1,39 @@
+package gopsd
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/solovev/gopsd/types"
+)
+
+func TestRenderSmartObjectStandardWarpWithoutMesh(t *testing.T) {
+	source := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	for i := range source.Pix {
+		source.Pix[i] = byte(i * 4)
+	}
+	render := func(style string) image.Image {
+		layer := &Layer{Name: style, SmartObject: &types.SmartObject{
+			Width: 4, Height: 4, Warp: &types.Warp{Style: style},
+			NonAffineTransform: [8]float64{2, 2, 10, 2, 10, 10, 2, 10},
+		}}
+		img, err := layer.RenderSmartObject(source, "Nearest neighbor")
+		if err != nil {
+			t.Fatalf("Warp \"%s\": %v", style, err)
+		}
+		return img
+	}
+
+	expected, warped := render("None"), render("Arc")
+	if expected.Bounds() != warped.Bounds() {
+		t.Fatalf("Bounds of unwarped content are %v, expected %v", warped.Bounds(), expected.Bounds())
+	}
+	for y := expected.Bounds().Min.Y; y < expected.Bounds().Max.Y; y++ {
+		for x := expected.Bounds().Min.X; x < expected.Bounds().Max.X; x++ {
+			if a, b := color.NRGBAModel.Convert(expected.At(x, y)), color.NRGBAModel.Convert(warped.At(x, y)); a != b {
+				t.Fatalf("Pixel %d, %d is %v, expected %v", x, y, b, a)
+			}
+		}
+	}
+}
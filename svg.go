@@ -0,0 +1,405 @@
+package gopsd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/solovev/gopsd/types"
+)
+
+// svgBlendModes maps blend modes to CSS "mix-blend-mode" values. Other modes are exported as normal.
+var svgBlendModes = map[string]string{
+	"Multiply": "multiply", "Screen": "screen", "Overlay": "overlay", "Darken": "darken", "Lighten": "lighten",
+	"Color dodge": "color-dodge", "Color burn": "color-burn", "Hard light": "hard-light", "Soft light": "soft-light",
+	"Difference": "difference", "Exclusion": "exclusion", "Hue": "hue", "Saturation": "saturation",
+	"Color": "color", "Luminosity": "luminosity",
+}
+
+// ExportSVG writes layers of document as SVG. Shape layers become paths with their fill and stroke,
+// groups become "g" elements with opacity, blend mode and masks, clipped layers are masked by their base.
+// Other layers, and shapes which can't be expressed in SVG (patterns, effects, layer masks),
+// are embedded as PNG images rendered with their effects. Effects of groups aren't exported.
+func (d *Document) ExportSVG(w io.Writer) error {
+	e := &svgExporter{document: d}
+	if err := e.layers(d.GetTreeRepresentation().Children); err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	out.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	fmt.Fprintf(&out, `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n",
+		d.Width, d.Height, d.Width, d.Height)
+	if e.defs.Len() > 0 {
+		out.WriteString("<defs>\n")
+		out.Write(e.defs.Bytes())
+		out.WriteString("</defs>\n")
+	}
+	out.Write(e.body.Bytes())
+	out.WriteString("</svg>\n")
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+type svgExporter struct {
+	document   *Document
+	defs, body bytes.Buffer
+	ids        int
+}
+
+// id returns unique identifier of element.
+func (e *svgExporter) id(prefix string) string {
+	e.ids++
+	return fmt.Sprintf("%s%d", prefix, e.ids)
+}
+
+// layers writes layers of tree, which are ordered from top to bottom, while SVG paints from bottom to top.
+func (e *svgExporter) layers(layers []*Layer) error {
+	for i := len(layers) - 1; i >= 0; i-- {
+		base := layers[i]
+		top := i
+		for top > 0 && layers[top-1].Clipping != 0 {
+			top--
+		}
+		id, err := e.layer(base)
+		if err != nil {
+			return err
+		}
+		if top < i {
+			mask := e.id("clip")
+			fmt.Fprintf(&e.defs, `<mask id="%s" mask-type="alpha" %s><use xlink:href="#%s"/></mask>`+"\n", mask, e.documentUnits(), id)
+			fmt.Fprintf(&e.body, `<g mask="url(#%s)">`+"\n", mask)
+			for j := i - 1; j >= top; j-- {
+				if _, err := e.layer(layers[j]); err != nil {
+					return err
+				}
+			}
+			e.body.WriteString("</g>\n")
+		}
+		i = top
+	}
+	return nil
+}
+
+// layer writes layer and returns identifier of its element.
+func (e *svgExporter) layer(l *Layer) (string, error) {
+	id := e.id("layer")
+	attributes := fmt.Sprintf(`id="%s" data-name="%s"`, id, svgEscape(l.Name))
+	if !l.Visible {
+		attributes += ` display="none"`
+	}
+	opacity := float64(l.Opacity) / 100
+
+	switch {
+	case l.IsFolder:
+		if l.BlendMode != "Pass through" {
+			attributes += svgStyle("isolation:isolate", svgBlend(l.BlendMode))
+		}
+		if mask := l.VectorMask; mask != nil && !mask.IsDisabled && mask.Path != nil {
+			attributes += fmt.Sprintf(` mask="url(#%s)"`, e.pathMask(mask.Path, mask.IsInverted))
+		}
+		fmt.Fprintf(&e.body, `<g %s%s>`+"\n", attributes, svgOpacity("opacity", opacity))
+		if l.HasMask() {
+			mask, err := e.layerMask(l)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(&e.body, `<g mask="url(#%s)">`+"\n", mask)
+		}
+		if err := e.layers(l.Children); err != nil {
+			return "", err
+		}
+		if l.HasMask() {
+			e.body.WriteString("</g>\n")
+		}
+		e.body.WriteString("</g>\n")
+	case l.Shape != nil && !l.hasEffects() && !l.HasMask() && svgPaintable(l.Shape):
+		opacity *= float64(l.FillOpacity) / 100
+		fmt.Fprintf(&e.body, `<g %s%s%s>`+"\n", attributes, svgOpacity("opacity", opacity), svgStyle(svgBlend(l.BlendMode)))
+		e.shape(l)
+		e.body.WriteString("</g>\n")
+	default:
+		img, err := l.GetRenderedImage()
+		if err != nil {
+			return "", err
+		}
+		if img == nil { // Nothing to render, e.g. adjustment layer
+			fmt.Fprintf(&e.body, `<g %s/>`+"\n", attributes)
+			break
+		}
+		uri, err := pngDataURI(img)
+		if err != nil {
+			return "", err
+		}
+		r := l.VisualRectangle()
+		fmt.Fprintf(&e.body, `<image %s x="%d" y="%d" width="%d" height="%d"%s%s xlink:href="%s"/>`+"\n",
+			attributes, r.X, r.Y, r.Width, r.Height, svgOpacity("opacity", opacity), svgStyle(svgBlend(l.BlendMode)), uri)
+	}
+	return id, nil
+}
+
+// shape writes fill and stroke of shape layer.
+func (e *svgExporter) shape(l *Layer) {
+	shape := l.Shape
+	path := shape.Path
+	inverted := l.VectorMask != nil && l.VectorMask.IsInverted
+	extent := path.Extent(1)
+
+	if shape.FillEnabled && shape.Fill != nil {
+		paint, opacity := e.paint(shape.Fill, extent)
+		if len(path.Subpaths) == 1 && !path.StartsWithAllPixels && !inverted &&
+			(path.Subpaths[0].Operation == "Combine" || path.Subpaths[0].Operation == "Exclude") {
+			fmt.Fprintf(&e.body, `<path d="%s" fill="%s"%s%s/>`+"\n", path.SVG(), paint, svgOpacity("fill-opacity", opacity), svgFillRule(path))
+		} else {
+			fmt.Fprintf(&e.body, `<rect x="0" y="0" width="%d" height="%d" fill="%s"%s mask="url(#%s)"/>`+"\n",
+				e.document.Width, e.document.Height, paint, svgOpacity("fill-opacity", opacity), e.pathMask(path, inverted))
+		}
+	}
+
+	stroke := shape.Stroke
+	if stroke == nil || !stroke.Enabled || stroke.Width <= 0 {
+		return
+	}
+	content := stroke.Content
+	if content == nil {
+		content = &types.FillContent{Type: "Color", Color: color.NRGBA{0, 0, 0, 255}}
+	}
+	paint, opacity := e.paint(content, extent)
+	width := stroke.Width
+	attributes := ""
+	switch stroke.Alignment {
+	case "Inside", "Outside":
+		// SVG strokes are centered, so stroke of double width is clipped by fill
+		width *= 2
+		attributes += fmt.Sprintf(` mask="url(#%s)"`, e.pathMask(path, stroke.Alignment == "Outside"))
+	}
+	attributes += fmt.Sprintf(` stroke-linecap="%s" stroke-linejoin="%s" stroke-miterlimit="%s"`,
+		svgEnum(stroke.Cap, "butt"), svgEnum(stroke.Join, "miter"), types.SVGNumber(math.Max(stroke.MiterLimit, 1)))
+	if len(stroke.Dashes) > 0 {
+		dashes := make([]string, len(stroke.Dashes))
+		for i, dash := range stroke.Dashes {
+			dashes[i] = types.SVGNumber(dash * stroke.Width)
+		}
+		attributes += fmt.Sprintf(` stroke-dasharray="%s" stroke-dashoffset="%s"`, strings.Join(dashes, " "), types.SVGNumber(stroke.DashOffset*stroke.Width))
+	}
+	fmt.Fprintf(&e.body, `<path d="%s" fill="none" stroke="%s" stroke-width="%s"%s%s%s/>`+"\n", path.SVG(), paint, types.SVGNumber(width),
+		svgOpacity("stroke-opacity", opacity*stroke.Opacity/100), attributes, svgStyle(svgBlend(stroke.BlendMode)))
+}
+
+// svgPaintable reports whether fill and stroke of shape can be expressed in SVG: colors and linear,
+// radial or reflected gradients.
+func svgPaintable(shape *types.Shape) bool {
+	paintable := func(content *types.FillContent) bool {
+		switch {
+		case content == nil || content.Type == "Color":
+			return true
+		case content.Type == "Gradient" && content.Gradient != nil && content.Gradient.Gradient != nil:
+			gradient := content.Gradient
+			return !gradient.Gradient.Noise && (gradient.Style == "Linear" || gradient.Style == "Radial" || gradient.Style == "Reflected")
+		}
+		return false
+	}
+	if shape.FillEnabled && !paintable(shape.Fill) {
+		return false
+	}
+	return shape.Stroke == nil || !shape.Stroke.Enabled || paintable(shape.Stroke.Content)
+}
+
+// paint returns value of "fill" or "stroke" attribute and opacity of paint.
+func (e *svgExporter) paint(content *types.FillContent, bounds image.Rectangle) (string, float64) {
+	if content.Type != "Gradient" {
+		c := content.Color
+		return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B), float64(c.A) / 255
+	}
+	fill := content.Gradient
+	if !fill.AlignWithLayer {
+		bounds = image.Rect(0, 0, int(e.document.Width), int(e.document.Height))
+	}
+	// The same placement as gradientPosition uses
+	w, h := float64(bounds.Dx()), float64(bounds.Dy())
+	cx := float64(bounds.Min.X) + w/2 + fill.OffsetX/100*w
+	cy := float64(bounds.Min.Y) + h/2 + fill.OffsetY/100*h
+	angle := fill.Angle * math.Pi / 180
+	cos, sin := math.Cos(angle), math.Sin(angle)
+	length := math.Max((math.Abs(w*cos)+math.Abs(h*sin))/2*math.Max(fill.Scale, 1)/100, 1e-6)
+	dx, dy := cos*length, -sin*length
+
+	id := e.id("gradient")
+	n := types.SVGNumber
+	switch fill.Style {
+	case "Radial":
+		fmt.Fprintf(&e.defs, `<radialGradient id="%s" gradientUnits="userSpaceOnUse" cx="%s" cy="%s" r="%s">`+"\n", id, n(cx), n(cy), n(length))
+	case "Reflected":
+		fmt.Fprintf(&e.defs, `<linearGradient id="%s" gradientUnits="userSpaceOnUse" x1="%s" y1="%s" x2="%s" y2="%s" spreadMethod="reflect">`+"\n",
+			id, n(cx), n(cy), n(cx+dx), n(cy+dy))
+	default:
+		fmt.Fprintf(&e.defs, `<linearGradient id="%s" gradientUnits="userSpaceOnUse" x1="%s" y1="%s" x2="%s" y2="%s">`+"\n",
+			id, n(cx-dx), n(cy-dy), n(cx+dx), n(cy+dy))
+	}
+	for _, t := range svgGradientOffsets(fill.Gradient) {
+		c, alpha := gradientColor(fill.Gradient, t)
+		offset := t
+		if fill.Reverse {
+			offset = 1 - t
+		}
+		stop := color.NRGBA{byte(clamp(c[0])*255 + 0.5), byte(clamp(c[1])*255 + 0.5), byte(clamp(c[2])*255 + 0.5), 255}
+		fmt.Fprintf(&e.defs, `<stop offset="%s" stop-color="#%02x%02x%02x"%s/>`+"\n", n(offset), stop.R, stop.G, stop.B, svgOpacity("stop-opacity", alpha))
+	}
+	if fill.Style == "Radial" {
+		e.defs.WriteString("</radialGradient>\n")
+	} else {
+		e.defs.WriteString("</linearGradient>\n")
+	}
+	return fmt.Sprintf("url(#%s)", id), 1
+}
+
+// svgGradientOffsets returns sorted positions of stops and midpoints of color and opacity stops.
+// SVG interpolates linearly between them.
+func svgGradientOffsets(gradient *types.Gradient) []float64 {
+	offsets := []float64{0, 1}
+	add := func(n int, stop func(i int) (location, midpoint float64)) {
+		for i := 0; i < n; i++ {
+			location, midpoint := stop(i)
+			offsets = append(offsets, location)
+			if i > 0 {
+				previous, _ := stop(i - 1)
+				offsets = append(offsets, previous+(location-previous)*midpoint)
+			}
+		}
+	}
+	add(len(gradient.Colors), func(i int) (float64, float64) { return gradient.Colors[i].Location, gradient.Colors[i].Midpoint })
+	add(len(gradient.Opacities), func(i int) (float64, float64) { return gradient.Opacities[i].Location, gradient.Opacities[i].Midpoint })
+	sort.Float64s(offsets)
+	var result []float64
+	for _, offset := range offsets {
+		offset = clamp(offset)
+		if len(result) == 0 || offset-result[len(result)-1] > 1e-6 {
+			result = append(result, offset)
+		}
+	}
+	return result
+}
+
+// pathMask defines luminance mask of path, built by operations of its subpaths, and returns its identifier.
+func (e *svgExporter) pathMask(path *types.Path, inverted bool) string {
+	var content string
+	if path.StartsWithAllPixels {
+		content += e.documentRect("white")
+	}
+	for _, subpath := range path.Subpaths {
+		d := fmt.Sprintf(`<path d="%s"%s`, subpath.SVG(), svgFillRule(path))
+		switch subpath.Operation {
+		case "Subtract":
+			content += d + ` fill="black"/>`
+		case "Intersect":
+			mask := e.id("mask")
+			fmt.Fprintf(&e.defs, `<mask id="%s" %s>%s fill="white"/></mask>`+"\n", mask, e.documentUnits(), d)
+			content = fmt.Sprintf(`<g mask="url(#%s)">%s</g>`, mask, content)
+		case "Exclude":
+			content += d + ` fill="white"` + svgStyle(svgBlend("Difference")) + "/>"
+		default:
+			content += d + ` fill="white"/>`
+		}
+	}
+	if inverted {
+		content = e.documentRect("white") + "<g" + svgStyle(svgBlend("Difference")) + ">" + content + `</g>`
+	}
+	id := e.id("mask")
+	fmt.Fprintf(&e.defs, `<mask id="%s" %s>%s</mask>`+"\n", id, e.documentUnits(), content)
+	return id
+}
+
+// layerMask defines luminance mask of user supplied layer mask and returns its identifier.
+func (e *svgExporter) layerMask(l *Layer) (string, error) {
+	_, rect, defaultColor, _ := l.userMask()
+	img := image.NewGray(image.Rect(0, 0, int(rect.Width), int(rect.Height)))
+	for y := 0; y < int(rect.Height); y++ {
+		for x := 0; x < int(rect.Width); x++ {
+			img.Pix[y*img.Stride+x] = byte(l.maskValue(x+int(rect.X), y+int(rect.Y))*255 + 0.5)
+		}
+	}
+	uri, err := pngDataURI(img)
+	if err != nil {
+		return "", err
+	}
+	background := fmt.Sprintf("#%02x%02x%02x", defaultColor, defaultColor, defaultColor)
+	id := e.id("mask")
+	fmt.Fprintf(&e.defs, `<mask id="%s" %s>%s<image x="%d" y="%d" width="%d" height="%d" xlink:href="%s"/></mask>`+"\n",
+		id, e.documentUnits(), e.documentRect(background), rect.X, rect.Y, rect.Width, rect.Height, uri)
+	return id, nil
+}
+
+// documentUnits returns attributes of mask which covers whole document.
+func (e *svgExporter) documentUnits() string {
+	return fmt.Sprintf(`maskUnits="userSpaceOnUse" x="0" y="0" width="%d" height="%d"`, e.document.Width, e.document.Height)
+}
+
+func (e *svgExporter) documentRect(fill string) string {
+	return fmt.Sprintf(`<rect x="0" y="0" width="%d" height="%d" fill="%s"/>`, e.document.Width, e.document.Height, fill)
+}
+
+func svgFillRule(path *types.Path) string {
+	if path.FillRule == "Even-odd" {
+		return ` fill-rule="evenodd"`
+	}
+	return ""
+}
+
+// svgOpacity returns opacity attribute, empty for opaque elements.
+func svgOpacity(name string, value float64) string {
+	if value >= 1 {
+		return ""
+	}
+	return fmt.Sprintf(` %s="%s"`, name, types.SVGNumber(math.Max(value, 0)))
+}
+
+// svgBlend returns "mix-blend-mode" property of blend mode, empty for normal and unsupported modes.
+func svgBlend(mode string) string {
+	if value, ok := svgBlendModes[mode]; ok {
+		return "mix-blend-mode:" + value
+	}
+	return ""
+}
+
+// svgStyle returns style attribute with not empty properties.
+func svgStyle(properties ...string) string {
+	var values []string
+	for _, property := range properties {
+		if property != "" {
+			values = append(values, property)
+		}
+	}
+	if len(values) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(` style="%s"`, strings.Join(values, ";"))
+}
+
+func svgEnum(name, def string) string {
+	if name == "" {
+		return def
+	}
+	return strings.ToLower(name)
+}
+
+func svgEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func pngDataURI(img image.Image) (string, error) {
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buffer.Bytes()), nil
+}
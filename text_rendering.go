@@ -0,0 +1,391 @@
+package gopsd
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/solovev/gopsd/types"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// RenderText renders text of text layer with fonts into image with bounds of layer's rectangle.
+// Text is the layer's one if nil, so changed content can be rendered with styles and geometry of layer.
+// Sizes of styles are multiplied by resolution of document / 72.
+// Paragraph text is wrapped into its box, point text grows from its anchor. Faux italic,
+// rotation and skew of text are not applied.
+func (l *Layer) RenderText(text *types.Text, fonts *Fonts) (image.Image, error) {
+	if text == nil {
+		text = l.Text()
+	}
+	if text == nil {
+		return nil, fmt.Errorf("[Layer: %s] Layer isn't a text layer", l.Name)
+	}
+	if fonts == nil {
+		return nil, fmt.Errorf("[Layer: %s] Fonts aren't specified", l.Name)
+	}
+	if l.document != nil {
+		text = text.Scaled(l.document.Resolution() / 72)
+	}
+
+	layout := &textLayout{text: text, fonts: fonts, hscale: 1, vscale: 1}
+	var matrix *types.Matrix
+	var box *types.RectangleFloat
+	if l.TypeTool != nil {
+		matrix, box = l.TypeTool.Transformation, l.TypeTool.Box()
+	} else if l.ObsoleteTypeTool != nil {
+		matrix = l.ObsoleteTypeTool.Transformation
+	}
+	if matrix != nil {
+		layout.x, layout.y = matrix.TX, matrix.TY
+		layout.hscale, layout.vscale = math.Hypot(matrix.XX, matrix.XY), math.Hypot(matrix.YX, matrix.YY)
+	}
+	if box != nil {
+		layout.box = &types.RectangleFloat{
+			Left:   layout.x + box.Left*layout.hscale,
+			Top:    layout.y + box.Top*layout.vscale,
+			Right:  layout.x + box.Right*layout.hscale,
+			Bottom: layout.y + box.Bottom*layout.vscale,
+		}
+	}
+
+	if err := layout.shape(); err != nil {
+		return nil, err
+	}
+	layout.breakLines()
+
+	r := l.Rectangle
+	img := image.NewRGBA(image.Rect(int(r.X), int(r.Y), int(r.X+r.Width), int(r.Y+r.Height)))
+	layout.draw(img)
+	return img, nil
+}
+
+// textLayout places glyphs of text in document coordinates.
+type textLayout struct {
+	text   *types.Text
+	fonts  *Fonts
+	x, y   float64               // Anchor of point text
+	box    *types.RectangleFloat // Frame of paragraph text
+	hscale float64
+	vscale float64
+
+	glyphs []*textGlyph
+	lines  []*textLine
+}
+
+type textGlyph struct {
+	char    rune
+	style   *types.CharacterStyle
+	face    font.Face
+	size    float64 // Font size, reduced for small caps, superscript and subscript
+	rise    float64 // Shift of baseline up
+	advance float64 // Including tracking
+	kern    float64 // Kerning with the previous glyph
+}
+
+type textLine struct {
+	glyphs    []*textGlyph
+	paragraph *types.ParagraphStyle
+	first     bool // First line of paragraph
+	last      bool // Last line of paragraph
+	ascent    float64
+	descent   float64
+	leading   float64
+}
+
+// Proportions of Photoshop's synthesized small caps, superscript and subscript.
+const (
+	smallCapsSize = 0.7
+	baselineSize  = 0.583
+	baselineRise  = 0.333
+)
+
+// shape creates glyphs for characters of text.
+func (t *textLayout) shape() error {
+	var previous *textGlyph
+	for i, char := range []rune(t.text.Text) {
+		style := t.styleAt(i)
+		glyph := &textGlyph{char: char, style: style, size: style.FontSize, rise: style.BaselineShift}
+		switch style.Caps {
+		case "All caps":
+			glyph.char = unicode.ToUpper(char)
+		case "Small caps":
+			if upper := unicode.ToUpper(char); upper != char {
+				glyph.char, glyph.size = upper, glyph.size*smallCapsSize
+			}
+		}
+		switch style.Baseline {
+		case "Superscript":
+			glyph.size *= baselineSize
+			glyph.rise += style.FontSize * baselineRise
+		case "Subscript":
+			glyph.size *= baselineSize
+			glyph.rise -= style.FontSize * baselineRise
+		}
+		t.glyphs = append(t.glyphs, glyph)
+		if glyph.size <= 0 {
+			previous = nil
+			continue
+		}
+
+		face, err := t.fonts.face(style.Font, glyph.size)
+		if err != nil {
+			return err
+		}
+		glyph.face = face
+		if char == '\n' {
+			previous = nil
+			continue
+		}
+		if advance, ok := face.GlyphAdvance(glyph.char); ok {
+			glyph.advance = float64(advance) / 64
+		}
+		glyph.advance += style.Tracking / 1000 * style.FontSize
+		if previous != nil && previous.face == face {
+			glyph.kern = float64(face.Kern(previous.char, glyph.char)) / 64
+		}
+		previous = glyph
+	}
+	return nil
+}
+
+// styleAt returns style of character, the default one if text has no styles for it.
+func (t *textLayout) styleAt(index int) *types.CharacterStyle {
+	for _, style := range t.text.Styles {
+		if index >= style.Start && index < style.Start+style.Length {
+			return style
+		}
+	}
+	if n := len(t.text.Styles); n > 0 {
+		return t.text.Styles[n-1]
+	}
+	return &types.CharacterStyle{FontSize: 12 * t.vscale, AutoLeading: true, Leading: 14.4 * t.vscale, Color: color.NRGBA{0, 0, 0, 255}}
+}
+
+// paragraphs returns paragraph styles covering the text, the last one is extended to the end of text.
+func (t *textLayout) paragraphs() []*types.ParagraphStyle {
+	n := len(t.text.Paragraphs)
+	if n == 0 {
+		return []*types.ParagraphStyle{{Length: len(t.glyphs), Alignment: "Left", AutoLeading: 1.2}}
+	}
+	paragraphs := append([]*types.ParagraphStyle(nil), t.text.Paragraphs...)
+	last := *paragraphs[n-1]
+	if end := last.Start + last.Length; end < len(t.glyphs) {
+		last.Length = len(t.glyphs) - last.Start
+		paragraphs[n-1] = &last
+	}
+	return paragraphs
+}
+
+// breakLines splits paragraphs into lines, wrapping them by width of box.
+func (t *textLayout) breakLines() {
+	for _, paragraph := range t.paragraphs() {
+		start, end := paragraph.Start, paragraph.Start+paragraph.Length
+		if end > len(t.glyphs) {
+			end = len(t.glyphs)
+		}
+		if start >= end {
+			continue
+		}
+		// Text changed after reading may have more line breaks than paragraph styles
+		for glyphs := t.glyphs[start:end]; len(glyphs) > 0; {
+			n := 0
+			for n < len(glyphs)-1 && glyphs[n].char != '\n' {
+				n++
+			}
+			t.breakParagraph(glyphs[:n+1], paragraph)
+			glyphs = glyphs[n+1:]
+		}
+	}
+}
+
+// breakParagraph splits paragraph (including its line break, which only adds its metrics) into lines.
+func (t *textLayout) breakParagraph(glyphs []*textGlyph, paragraph *types.ParagraphStyle) {
+	first := len(t.lines)
+	for len(glyphs) > 0 {
+		n := t.fit(glyphs, t.width(paragraph, len(t.lines) == first))
+		t.addLine(glyphs[:n], paragraph, len(t.lines) == first)
+		glyphs = glyphs[n:]
+	}
+	t.lines[len(t.lines)-1].last = true
+}
+
+// width returns available width for line of paragraph, infinite for point text.
+func (t *textLayout) width(paragraph *types.ParagraphStyle, first bool) float64 {
+	if t.box == nil {
+		return math.Inf(1)
+	}
+	width := t.box.Right - t.box.Left - paragraph.StartIndent - paragraph.EndIndent
+	if first {
+		width -= paragraph.FirstLineIndent
+	}
+	return width
+}
+
+// fit returns count of glyphs of the next line. Lines are broken after spaces, long words are broken anywhere.
+func (t *textLayout) fit(glyphs []*textGlyph, width float64) int {
+	x, breakAt := 0.0, 0
+	for i, glyph := range glyphs {
+		if i > 0 {
+			x += glyph.kern
+		}
+		if unicode.IsSpace(glyph.char) {
+			breakAt = i + 1
+		} else if x+glyph.advance > width && i > 0 {
+			if breakAt > 0 {
+				return breakAt
+			}
+			return i
+		}
+		x += glyph.advance
+	}
+	return len(glyphs)
+}
+
+func (t *textLayout) addLine(glyphs []*textGlyph, paragraph *types.ParagraphStyle, first bool) {
+	line := &textLine{glyphs: glyphs, paragraph: paragraph, first: first}
+	for _, glyph := range glyphs {
+		if glyph.face != nil {
+			metrics := glyph.face.Metrics()
+			line.ascent = math.Max(line.ascent, float64(metrics.Ascent)/64+glyph.rise)
+			line.descent = math.Max(line.descent, float64(metrics.Descent)/64-glyph.rise)
+		}
+		line.leading = math.Max(line.leading, glyph.style.Leading)
+	}
+	t.lines = append(t.lines, line)
+}
+
+// measure returns width of line without trailing spaces and count of inner spaces.
+func (line *textLine) measure() (width float64, spaces int) {
+	glyphs := line.glyphs
+	for len(glyphs) > 0 && unicode.IsSpace(glyphs[len(glyphs)-1].char) {
+		glyphs = glyphs[:len(glyphs)-1]
+	}
+	for i, glyph := range glyphs {
+		if i > 0 {
+			width += glyph.kern
+		}
+		width += glyph.advance
+		if unicode.IsSpace(glyph.char) {
+			spaces++
+		}
+	}
+	return width, spaces
+}
+
+// alignment returns alignment of line, justified paragraphs have their last lines aligned by justification.
+func (line *textLine) alignment() (align string, justify bool) {
+	align = line.paragraph.Alignment
+	if !strings.HasPrefix(align, "Justify") {
+		return align, false
+	}
+	if !line.last || align == "Justify all" {
+		return "Left", true
+	}
+	switch align {
+	case "Justify right":
+		return "Right", false
+	case "Justify center":
+		return "Center", false
+	}
+	return "Left", false
+}
+
+func (t *textLayout) draw(img *image.RGBA) {
+	var baseline float64
+	for i, line := range t.lines {
+		paragraph := line.paragraph
+		switch {
+		case i == 0 && t.box != nil:
+			baseline = t.box.Top + line.ascent
+		case i == 0:
+			baseline = t.y
+		default:
+			baseline += line.leading
+			if line.first {
+				baseline += t.lines[i-1].paragraph.SpaceAfter + paragraph.SpaceBefore
+			}
+		}
+		if t.box != nil && baseline+line.descent > t.box.Bottom {
+			break // Photoshop hides lines overflowing the box
+		}
+
+		width, spaces := line.measure()
+		indent := paragraph.StartIndent
+		if line.first {
+			indent += paragraph.FirstLineIndent
+		}
+		align, justify := line.alignment()
+		var x, extra float64
+		if t.box != nil {
+			available := t.width(paragraph, line.first)
+			x = t.box.Left + indent
+			switch align {
+			case "Right":
+				x += available - width
+			case "Center":
+				x += (available - width) / 2
+			}
+			if justify && spaces > 0 {
+				extra = (available - width) / float64(spaces)
+			}
+		} else {
+			switch align {
+			case "Right":
+				x = t.x - paragraph.EndIndent - width
+			case "Center":
+				x = t.x + (indent-paragraph.EndIndent)/2 - width/2
+			default:
+				x = t.x + indent
+			}
+		}
+
+		for j, glyph := range line.glyphs {
+			if j > 0 {
+				x += glyph.kern
+			}
+			t.drawGlyph(img, glyph, x, baseline)
+			x += glyph.advance
+			if unicode.IsSpace(glyph.char) {
+				x += extra
+			}
+		}
+	}
+}
+
+func (t *textLayout) drawGlyph(img *image.RGBA, glyph *textGlyph, x, baseline float64) {
+	if glyph.face == nil || glyph.char == '\n' {
+		return
+	}
+	style := glyph.style
+	source := image.NewUniform(style.Color)
+	y := baseline - glyph.rise
+	offsets := []float64{0}
+	if style.FauxBold {
+		offsets = append(offsets, math.Max(0.5, style.FontSize/40))
+	}
+	for _, offset := range offsets {
+		dot := fixed.Point26_6{X: fixed.Int26_6(math.Round((x + offset) * 64)), Y: fixed.Int26_6(math.Round(y * 64))}
+		dr, mask, maskp, _, ok := glyph.face.Glyph(dot, glyph.char)
+		if ok {
+			draw.DrawMask(img, dr, source, image.Point{}, mask, maskp, draw.Over)
+		}
+	}
+
+	thickness := math.Max(1, style.FontSize/15)
+	line := func(top float64) {
+		rect := image.Rect(int(math.Floor(x)), int(math.Round(top)), int(math.Ceil(x+glyph.advance)), int(math.Round(top+thickness)))
+		draw.Draw(img, rect, source, image.Point{}, draw.Over)
+	}
+	if style.Underline {
+		line(y + glyph.size*0.1)
+	}
+	if style.Strikethrough {
+		line(y - glyph.size*0.3)
+	}
+}
@@ -1,6 +1,11 @@
 package types
 
-import "github.com/solovev/gopsd/util"
+import (
+	"image/color"
+	"math"
+
+	"github.com/solovev/gopsd/util"
+)
 
 type Color struct {
 	red, green, blue, alpha int16
@@ -25,3 +30,111 @@ func (c Color) Alpha() int16 {
 func NewRGBAColor(reader *util.Reader) *Color {
 	return &Color{reader.ReadInt16(), reader.ReadInt16(), reader.ReadInt16(), reader.ReadInt16()}
 }
+
+// NRGBA interprets components according to color space of color structure:
+// 0 = RGB, 1 = HSB, 2 = CMYK, 7 = Lab, 8 = Grayscale.
+func (c Color) NRGBA(colorSpace int16) color.NRGBA {
+	unit := func(value int16) float64 {
+		return float64(uint16(value)) / 65535
+	}
+	var r, g, b float64
+	switch colorSpace {
+	case 1:
+		r, g, b = hsbToRGB(unit(c.red)*360, unit(c.green), unit(c.blue))
+	case 2: // 0 = 100% ink
+		r, g, b = cmykToRGB(1-unit(c.red), 1-unit(c.green), 1-unit(c.blue), 1-unit(c.alpha))
+	case 7: // L = 0...10000, a and b = -12800...12700
+		r, g, b = labToRGB(float64(c.red)/100, float64(c.green)/100, float64(c.blue)/100)
+	case 8: // 0...10000
+		r = float64(c.red) / 10000
+		g, b = r, r
+	default:
+		r, g, b = unit(c.red), unit(c.green), unit(c.blue)
+	}
+	return color.NRGBA{toByte(r), toByte(g), toByte(b), 255}
+}
+
+// readDescriptorColor converts color object of descriptor (RGBC, HSBC, CMYC, Grsc, LbCl) to RGB.
+func readDescriptorColor(d *Descriptor) color.NRGBA {
+	if d == nil {
+		return color.NRGBA{0, 0, 0, 255}
+	}
+	var r, g, b float64
+	switch d.Class {
+	case "HSBC":
+		r, g, b = hsbToRGB(d.getFloat("H   ", 0), d.getFloat("Strt", 0)/100, d.getFloat("Brgh", 0)/100)
+	case "CMYC":
+		r, g, b = cmykToRGB(d.getFloat("Cyn ", 0)/100, d.getFloat("Mgnt", 0)/100, d.getFloat("Ylw ", 0)/100, d.getFloat("Blck", 0)/100)
+	case "Grsc":
+		r = 1 - d.getFloat("Gry ", 0)/100
+		g, b = r, r
+	case "LbCl":
+		r, g, b = labToRGB(d.getFloat("Lmnc", 0), d.getFloat("A   ", 0), d.getFloat("B   ", 0))
+	default: // RGBC
+		if d.has("redFloat") {
+			r, g, b = d.getFloat("redFloat", 0), d.getFloat("greenFloat", 0), d.getFloat("blueFloat", 0)
+		} else {
+			r, g, b = d.getFloat("Rd  ", 0)/255, d.getFloat("Grn ", 0)/255, d.getFloat("Bl  ", 0)/255
+		}
+	}
+	return color.NRGBA{toByte(r), toByte(g), toByte(b), 255}
+}
+
+func toByte(value float64) uint8 {
+	return uint8(math.Max(0, math.Min(1, value))*255 + 0.5)
+}
+
+// hsbToRGB converts hue (degrees), saturation and brightness (0-1) to RGB (0-1).
+func hsbToRGB(h, s, v float64) (r, g, b float64) {
+	h = math.Mod(h, 360)
+	if h < 0 {
+		h += 360
+	}
+	c := v * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	switch int(h / 60) {
+	case 0:
+		r, g, b = c, x, 0
+	case 1:
+		r, g, b = x, c, 0
+	case 2:
+		r, g, b = 0, c, x
+	case 3:
+		r, g, b = 0, x, c
+	case 4:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	m := v - c
+	return r + m, g + m, b + m
+}
+
+// cmykToRGB converts CMYK (0-1) to RGB (0-1) without color profile.
+func cmykToRGB(c, m, y, k float64) (r, g, b float64) {
+	return (1 - c) * (1 - k), (1 - m) * (1 - k), (1 - y) * (1 - k)
+}
+
+// labToRGB converts CIE Lab (D50, as used by Photoshop) to sRGB (0-1).
+func labToRGB(l, a, b float64) (float64, float64, float64) {
+	finv := func(t float64) float64 {
+		if t > 6.0/29 {
+			return t * t * t
+		}
+		return 3 * (6.0 / 29) * (6.0 / 29) * (t - 4.0/29)
+	}
+	fy := (l + 16) / 116
+	x := 0.9642 * finv(fy+a/500)
+	y := finv(fy)
+	z := 0.8249 * finv(fy-b/200)
+
+	gamma := func(c float64) float64 {
+		if c <= 0.0031308 {
+			return 12.92 * c
+		}
+		return 1.055*math.Pow(c, 1/2.4) - 0.055
+	}
+	return gamma(3.1338561*x - 1.6168667*y - 0.4906146*z),
+		gamma(-0.9787684*x + 1.9161415*y + 0.0334540*z),
+		gamma(0.0719453*x - 0.2289914*y + 1.4052427*z)
+}
@@ -10,18 +10,32 @@ import (
 	"github.com/solovev/gopsd/util"
 )
 
+// Descriptor stores items in the order they are written in file.
+// Problems found while reading (e.g. unknown item types) are listed in Warnings of the root descriptor,
+// items which couldn't be decoded into typed values are listed in Warnings of their descriptor.
 type Descriptor struct {
-	Name  string
-	Class string
-	Items map[string]*DescriptorEntity
+	Name     string
+	Class    string
+	Items    []*DescriptorEntity
+	Warnings []string `json:",omitempty"`
+
+	truncated bool             // Reading stopped at unknown item (see Raw), stream position is undefined
+	count     int32            // Number of items as written in file, if reading stopped at unknown item
+	stringIDs map[*string]bool // Fields of 4-character IDs written as strings rather than as character codes, shared with root
 }
 
+// DescriptorEntity is an item of descriptor, list ("VlLs") or reference ("obj ").
+// Items of lists and references have empty keys. Raw is data of "alis", "Pth " and "tdta" items
+// as it was read; for items of unknown type it is all bytes after the type up to the end of data
+// descriptor is read from (tagged block of layer, image resource or record of linked file).
 type DescriptorEntity struct {
 	Key   string
 	Type  string
 	Value interface{}
 
 	Raw string `json:"-"`
+
+	count int32 // Number of list or reference items as written in file, if reading stopped at unknown item
 }
 
 type DescriptorUnitFloat struct {
@@ -29,6 +43,24 @@ type DescriptorUnitFloat struct {
 	Value float64
 }
 
+// DescriptorUnitFloats is a list of unit floats ("UnFl").
+type DescriptorUnitFloats struct {
+	Type   string
+	Values []float64
+}
+
+// DescriptorObjectArray ("ObAr") stores lists of values (mostly "UnFl") as items of descriptor.
+type DescriptorObjectArray struct {
+	Count int32
+	*Descriptor
+}
+
+// DescriptorPath is a file path ("Pth ").
+type DescriptorPath struct {
+	Signature string // "txtu"
+	Path      string
+}
+
 type DescriptorClass struct {
 	Name  string
 	Class string
@@ -52,20 +84,51 @@ type DescriptorReferenceEnum struct {
 	Enum  string
 }
 
+// DescriptorOffset is a reference by offset ("rele"), identifier ("Idnt") or index ("indx").
 type DescriptorOffset struct {
 	Name  string
 	Class string
 	Value int32
 }
 
+// DescriptorName is a reference by name ("name").
+type DescriptorName struct {
+	Name  string
+	Class string
+	Value string
+}
+
 func NewDescriptor(reader *util.Reader) *Descriptor {
 	value := new(Descriptor)
+	value.stringIDs = make(map[*string]bool)
+	value.truncated = !readDescriptor(value, value, reader)
+	return value
+}
 
+// readDescriptor reads descriptor into value, reporting warnings to root.
+// Returns false if descriptor contains unknown item type and the rest of it was not read.
+func readDescriptor(value, root *Descriptor, reader *util.Reader) bool {
+	value.stringIDs = root.stringIDs
 	value.Name = reader.ReadUnicodeString()
-	value.Class = reader.ReadDynamicString()
-	value.Items = newDescriptorList(value, reader)
+	root.readID(reader, &value.Class)
 
-	return value
+	var ok bool
+	value.Items, value.count, ok = newDescriptorList(root, true, reader)
+	return ok
+}
+
+// readID reads class, key or enum ID into id. IDs are either 4-character codes (stored with zero length)
+// or strings. The root remembers which 4-character IDs are strings to write them back the same way.
+func (root *Descriptor) readID(reader *util.Reader, id *string) {
+	length := int(reader.ReadInt32())
+	if length == 0 {
+		*id = reader.ReadString(4)
+		return
+	}
+	*id = reader.ReadString(length)
+	if length == 4 {
+		root.stringIDs[id] = true
+	}
 }
 
 func newDescriptorUnitFloat(reader *util.Reader) *DescriptorUnitFloat {
@@ -75,214 +138,195 @@ func newDescriptorUnitFloat(reader *util.Reader) *DescriptorUnitFloat {
 	return unit
 }
 
-func newDescriptorClass(reader *util.Reader) *DescriptorClass {
+func newDescriptorUnitFloats(reader *util.Reader) *DescriptorUnitFloats {
+	unit := new(DescriptorUnitFloats)
+	unit.Type = reader.ReadString(4)
+	unit.Values = make([]float64, reader.ReadInt32())
+	for i := range unit.Values {
+		unit.Values[i] = reader.ReadFloat64()
+	}
+	return unit
+}
+
+// newDescriptorPath reads "Pth " item, which is (unlike the rest of descriptor) little endian.
+func newDescriptorPath(b []byte) *DescriptorPath {
+	path := new(DescriptorPath)
+	if len(b) < 12 {
+		return path
+	}
+	path.Signature = string(b[:4])
+	count := int(binary.LittleEndian.Uint32(b[8:12]))
+	if count > (len(b)-12)/2 {
+		count = (len(b) - 12) / 2
+	}
+	path.Path = strings.TrimRight(util.BytesToUTF16(b[12:12+2*count], binary.LittleEndian), "\x00")
+	return path
+}
+
+func newDescriptorClass(root *Descriptor, reader *util.Reader) *DescriptorClass {
 	class := new(DescriptorClass)
 	class.Name = reader.ReadUnicodeString()
-	class.Class = reader.ReadDynamicString()
+	root.readID(reader, &class.Class)
 	return class
 }
 
-func newDescriptorEnum(reader *util.Reader) *DescriptorEnum {
+func newDescriptorEnum(root *Descriptor, reader *util.Reader) *DescriptorEnum {
 	enum := new(DescriptorEnum)
-	enum.Type = reader.ReadDynamicString()
-	enum.Enum = reader.ReadDynamicString()
+	root.readID(reader, &enum.Type)
+	root.readID(reader, &enum.Enum)
 	return enum
 }
 
-func newDescriptorList(descriptor *Descriptor, reader *util.Reader) map[string]*DescriptorEntity {
-	value := make(map[string]*DescriptorEntity)
+// newDescriptorList reads items of descriptor (keyed) or "VlLs" list.
+// Unknown item types can't be skipped, so reading stops at them: the item is kept with its type,
+// nil value and all bytes after its type as Raw, warning is added to root and false is returned
+// along with number of items as written in file.
+func newDescriptorList(root *Descriptor, keyed bool, reader *util.Reader) ([]*DescriptorEntity, int32, bool) {
 	count := reader.ReadInt32()
+	var value []*DescriptorEntity
 	for i := 0; i < int(count); i++ {
 		entity := new(DescriptorEntity)
-		if descriptor != nil {
-			entity.Key = reader.ReadDynamicString()
+		if keyed {
+			root.readID(reader, &entity.Key)
 		}
 		entity.Type = reader.ReadString(4)
-		switch entity.Type {
-		case "obj ":
-			entity.Value = newDescriptorReference(reader)
-		case "Objc", "GlbO":
-			entity.Value = NewDescriptor(reader)
-		case "VlLs":
-			entity.Value = newDescriptorList(nil, reader)
-		case "doub":
-			entity.Value = reader.ReadFloat64()
-		case "UntF":
-			entity.Value = newDescriptorUnitFloat(reader)
-		case "TEXT":
-			entity.Value = reader.ReadUnicodeString()
-		case "enum":
-			entity.Value = newDescriptorEnum(reader)
-		case "long":
-			entity.Value = reader.ReadInt32()
-		case "bool":
-			entity.Value = reader.ReadByte() == 1
-		case "type", "GlbC":
-			entity.Value = newDescriptorClass(reader)
-		case "alis": // TODO
-			reader.Skip(reader.ReadInt32())
-		case "tdta":
-			bytes := reader.ReadBytes(reader.ReadInt32())
-
-			entity.Raw = string(bytes)
-
-			r := util.NewReader(bytes)
-			entity.Value = readTextData(r)
-		default:
-			panic(fmt.Sprintf("Unknown OSType key [%s] in entity [%s]", entity.Type, entity.Key))
+		value = append(value, entity)
+		if !readDescriptorValue(entity, root, reader) {
+			return value, count, false
 		}
-		value[entity.Key] = entity
 	}
-	return value
+	return value, 0, true
 }
 
-func readTextData(r *util.Reader) interface{} {
-	r.SkipWhitespaces()
-	c := r.ReadByte()
-	switch c {
-	case 60: // "<" - Starting of map
-		r.Skip(1) // "<"
-		collection := make(map[string]interface{})
-		for {
-			r.SkipWhitespaces()
-			switch r.ReadByte() {
-			case 47: // "/"
-				var name []byte
-				for {
-					char := r.ReadByte()
-					// If byte is letter (a-zA-Z)
-					if (char >= 65 && char <= 90) || (char >= 97 && char <= 122) {
-						name = append(name, char)
-					} else {
-						r.UnreadByte()
-						break
-					}
-				}
-				collection[string(name)] = readTextData(r)
-			case 62: // ">"
-				r.Skip(1)
-				return collection
-			}
-		}
-	case 40: // "(" - Starting of utf16 string
-		r.Skip(2) // 254 & 255
-		var buffer []byte
-		for {
-			b := r.ReadByte()
-			n := len(buffer)
-			if n > 0 && buffer[n-1] == 0 && b == 13 {
-				buffer = buffer[0 : n-1]
-				continue
-			}
-			// Break if byte is ")" and length of buffer is 0 or previous byte isn't "\"
-			if b == 41 {
-				if n == 0 || buffer[n-1] != 92 {
-					break
-				} else {
-					buffer = append(buffer, 0)
-				}
-			}
-			buffer = append(buffer, b)
-		}
-		return util.BytesToUTF16(buffer, binary.BigEndian)
-	case 91: // - Starting of array
-		var list []interface{}
-		for {
-			c = r.ReadByte()
-			if c == 9 || c == 10 || c == 32 {
-				continue
-			}
-			if c == 93 {
-				return list
-			}
-			r.UnreadByte()
-			list = append(list, readTextData(r))
-		}
-	default: // Primitive object (boolean/float)
-		switch c {
-		case 116: // "t"
-			r.Skip(3) // Skip "rue"
-			return true
-		case 102: // "f"
-			r.Skip(4) // Skip "alse"
-			return false
-		default:
-			array := []byte{c}
-			for {
-				c = r.ReadByte()
-				// if byte is "." or diggit
-				if c == 46 || (c >= 48 && c <= 57) {
-					array = append(array, c)
-				} else {
-					r.UnreadByte()
-					break
-				}
-			}
-			result, err := strconv.ParseFloat(string(array), 64)
-			if err != nil {
-				panic(err)
-			}
-			return result
+// readDescriptorValue reads value of entity by its type.
+func readDescriptorValue(entity *DescriptorEntity, root *Descriptor, reader *util.Reader) bool {
+	switch entity.Type {
+	case "obj ":
+		list, count, ok := newDescriptorReference(root, reader)
+		entity.Value, entity.count = list, count
+		return ok
+	case "Objc", "GlbO":
+		descriptor := new(Descriptor)
+		entity.Value = descriptor
+		return readDescriptor(descriptor, root, reader)
+	case "ObAr":
+		array := &DescriptorObjectArray{reader.ReadInt32(), new(Descriptor)}
+		entity.Value = array
+		return readDescriptor(array.Descriptor, root, reader)
+	case "VlLs":
+		list, count, ok := newDescriptorList(root, false, reader)
+		entity.Value, entity.count = list, count
+		return ok
+	case "doub":
+		entity.Value = reader.ReadFloat64()
+	case "UntF":
+		entity.Value = newDescriptorUnitFloat(reader)
+	case "UnFl":
+		entity.Value = newDescriptorUnitFloats(reader)
+	case "TEXT":
+		entity.Value = reader.ReadUnicodeString()
+	case "enum":
+		entity.Value = newDescriptorEnum(root, reader)
+	case "long":
+		entity.Value = reader.ReadInt32()
+	case "comp":
+		entity.Value = reader.ReadInt64()
+	case "bool":
+		entity.Value = reader.ReadByte() == 1
+	case "type", "GlbC":
+		entity.Value = newDescriptorClass(root, reader)
+	case "alis":
+		bytes := reader.ReadBytes(reader.ReadInt32())
+		entity.Raw = string(bytes)
+		entity.Value = bytes
+	case "Pth ":
+		bytes := reader.ReadBytes(reader.ReadInt32())
+		entity.Raw = string(bytes)
+		entity.Value = newDescriptorPath(bytes)
+	case "tdta":
+		bytes := reader.ReadBytes(reader.ReadInt32())
+		entity.Raw = string(bytes)
+
+		value, err := ParseEngineData(bytes)
+		if err != nil {
+			root.Warnings = append(root.Warnings, fmt.Sprintf("Can't parse text data [%s]: %v", entity.Key, err))
+			value = entity.Raw
 		}
+		entity.Value = value
+	default:
+		root.Warnings = append(root.Warnings, fmt.Sprintf("Unknown OSType key [%s] in entity [%s], rest of descriptor is kept as raw data", entity.Type, entity.Key))
+		entity.Raw = string(reader.Rest())
+		return false
 	}
+	return true
 }
 
-func newDescriptorReference(reader *util.Reader) map[string]*DescriptorEntity {
-	value := make(map[string]*DescriptorEntity)
+func newDescriptorReference(root *Descriptor, reader *util.Reader) ([]*DescriptorEntity, int32, bool) {
 	count := reader.ReadInt32()
+	var value []*DescriptorEntity
 	for i := 0; i < int(count); i++ {
 		entity := new(DescriptorEntity)
 		entity.Type = reader.ReadString(4)
+		value = append(value, entity)
 		switch entity.Type {
 		case "prop":
-			entity.Value = newDescriptorProperty(reader)
+			entity.Value = newDescriptorProperty(root, reader)
 		case "Clss":
-			entity.Value = newDescriptorClass(reader)
+			entity.Value = newDescriptorClass(root, reader)
 		case "Enmr":
-			entity.Value = newDescriptorReferenceEnum(reader)
-		case "rele":
-			entity.Value = newDescriptorOffset(reader)
-		case "Idnt":
-		case "indx":
+			entity.Value = newDescriptorReferenceEnum(root, reader)
+		case "rele", "Idnt", "indx":
+			entity.Value = newDescriptorOffset(root, reader)
 		case "name":
+			entity.Value = newDescriptorName(root, reader)
 		default:
-			panic(fmt.Sprintf("Unknown OSType key [%s] in entity [%s]", entity.Type, entity.Key))
+			root.Warnings = append(root.Warnings, fmt.Sprintf("Unknown reference type [%s], rest of descriptor is kept as raw data", entity.Type))
+			entity.Raw = string(reader.Rest())
+			return value, count, false
 		}
-		value[entity.Key] = entity
 	}
-	return value
+	return value, 0, true
 }
 
-func newDescriptorProperty(reader *util.Reader) *DescriptorProperty {
+func newDescriptorProperty(root *Descriptor, reader *util.Reader) *DescriptorProperty {
 	property := new(DescriptorProperty)
 	property.Name = reader.ReadUnicodeString()
-	property.Class = reader.ReadDynamicString()
-	property.Key = reader.ReadDynamicString()
+	root.readID(reader, &property.Class)
+	root.readID(reader, &property.Key)
 	return property
 }
 
-func newDescriptorReferenceEnum(reader *util.Reader) *DescriptorReferenceEnum {
+func newDescriptorReferenceEnum(root *Descriptor, reader *util.Reader) *DescriptorReferenceEnum {
 	enum := new(DescriptorReferenceEnum)
 	enum.Name = reader.ReadUnicodeString()
-	enum.Class = reader.ReadDynamicString()
-	enum.Type = reader.ReadDynamicString()
-	enum.Enum = reader.ReadDynamicString()
+	root.readID(reader, &enum.Class)
+	root.readID(reader, &enum.Type)
+	root.readID(reader, &enum.Enum)
 	return enum
 }
 
-func newDescriptorOffset(reader *util.Reader) *DescriptorOffset {
+func newDescriptorOffset(root *Descriptor, reader *util.Reader) *DescriptorOffset {
 	offset := new(DescriptorOffset)
 	offset.Name = reader.ReadUnicodeString()
-	offset.Class = reader.ReadDynamicString()
+	root.readID(reader, &offset.Class)
 	offset.Value = reader.ReadInt32()
 	return offset
 }
 
+func newDescriptorName(root *Descriptor, reader *util.Reader) *DescriptorName {
+	name := new(DescriptorName)
+	name.Name = reader.ReadUnicodeString()
+	root.readID(reader, &name.Class)
+	name.Value = reader.ReadUnicodeString()
+	return name
+}
+
+// GetValue returns value by path of keys separated by "->". Items of lists are addressed by index, e.g. "Clrs->#3->Clr ".
 func (d *Descriptor) GetValue(path string) (interface{}, error) {
 	return getValue(path, "Root", d.Items)
 }
 
-func getValue(path, collectionName string, collection map[string]*DescriptorEntity) (interface{}, error) {
+func getValue(path, collectionName string, collection []*DescriptorEntity) (interface{}, error) {
 	pathSplit := strings.Split(path, "->")
 	pathSlice := strings.TrimSpace(pathSplit[0])
 	pathIndex := -1
@@ -296,9 +340,8 @@ func getValue(path, collectionName string, collection map[string]*DescriptorEnti
 			pathIndex = itemIndex
 		}
 	}
-	i := 0
-	for key, item := range collection {
-		if i == pathIndex || key == pathSlice {
+	for i, item := range collection {
+		if i == pathIndex || (pathIndex == -1 && strings.TrimSpace(item.Key) == pathSlice) { // Path is trimmed, so keys are compared without padding
 			if item.Type == "tdta" {
 				if len(pathSplit) > 1 {
 					return getTextDataValue(strings.Join(pathSplit[1:], "->"), item.Key, item.Value)
@@ -306,7 +349,7 @@ func getValue(path, collectionName string, collection map[string]*DescriptorEnti
 				return item.Value, nil
 			}
 			switch instance := item.Value.(type) {
-			case map[string]*DescriptorEntity:
+			case []*DescriptorEntity:
 				if len(pathSplit) > 1 {
 					return getValue(strings.Join(pathSplit[1:], "->"), item.Key, instance)
 				}
@@ -316,20 +359,111 @@ func getValue(path, collectionName string, collection map[string]*DescriptorEnti
 					return getValue(strings.Join(pathSplit[1:], "->"), item.Key, instance.Items)
 				}
 				return instance.string(0), nil
-			case float64, int32, bool, string:
+			case *DescriptorObjectArray:
+				if len(pathSplit) > 1 {
+					return getValue(strings.Join(pathSplit[1:], "->"), item.Key, instance.Items)
+				}
+				return instance.string(0), nil
+			case float64, int32, int64, bool, string:
 				return instance, nil
 			case *DescriptorUnitFloat:
 				return instance.Value, nil
+			case *DescriptorUnitFloats:
+				return instance.Values, nil
+			case *DescriptorPath:
+				return instance.Path, nil
 			default:
 				return nil, fmt.Errorf("Can't get value of \"%s\". Unsupported type \"%s\"", pathSlice, item.Type)
 			}
 		}
-		i++
 	}
-	if i == len(collection) {
-		return nil, fmt.Errorf("Item \"%s\" does not exist in \"%s\"", pathSlice, collectionName)
+	return nil, fmt.Errorf("Item \"%s\" does not exist in \"%s\"", pathSlice, collectionName)
+}
+
+// item returns the first entity with key or nil. Safe for nil descriptor.
+func (d *Descriptor) item(key string) *DescriptorEntity {
+	if d == nil {
+		return nil
+	}
+	for _, item := range d.Items {
+		if item.Key == key {
+			return item
+		}
+	}
+	return nil
+}
+
+func (d *Descriptor) has(key string) bool {
+	return d.item(key) != nil
+}
+
+func (d *Descriptor) getBool(key string, def bool) bool {
+	if item := d.item(key); item != nil {
+		if value, ok := item.Value.(bool); ok {
+			return value
+		}
+	}
+	return def
+}
+
+// getFloat returns value of "doub", "UntF" or "long" item.
+func (d *Descriptor) getFloat(key string, def float64) float64 {
+	if item := d.item(key); item != nil {
+		return entityFloat(item, def)
+	}
+	return def
+}
+
+func entityFloat(item *DescriptorEntity, def float64) float64 {
+	switch value := item.Value.(type) {
+	case float64:
+		return value
+	case *DescriptorUnitFloat:
+		return value.Value
+	case int32:
+		return float64(value)
+	case int64:
+		return float64(value)
+	}
+	return def
+}
+
+func (d *Descriptor) getString(key string) string {
+	if item := d.item(key); item != nil {
+		if value, ok := item.Value.(string); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// getEnum returns value of "enum" item.
+func (d *Descriptor) getEnum(key string) string {
+	if item := d.item(key); item != nil {
+		if value, ok := item.Value.(*DescriptorEnum); ok {
+			return value.Enum
+		}
+	}
+	return ""
+}
+
+func (d *Descriptor) getDescriptor(key string) *Descriptor {
+	if item := d.item(key); item != nil {
+		if value, ok := item.Value.(*Descriptor); ok {
+			return value
+		}
+	}
+	return nil
+}
+
+// getList returns entities of "VlLs" item.
+func (d *Descriptor) getList(key string) []*DescriptorEntity {
+	item := d.item(key)
+	if item == nil {
+		return nil
 	}
-	return stringList(collection, 0), nil
+	list, _ := item.Value.([]*DescriptorEntity)
+	return list
 }
 
 func getTextDataValue(path, collectionName string, collection interface{}) (interface{}, error) {
@@ -388,27 +522,35 @@ func (d Descriptor) string(indent int) string {
 	return sm.String()
 }
 
-func stringList(items map[string]*DescriptorEntity, indent int) string {
+func stringList(items []*DescriptorEntity, indent int) string {
 	sm := new(util.StringMixer)
 
 	for _, item := range items {
 		sm.AddIndent(indent+1).Add("[", item.Type, "] \"", item.Key, "\": ")
 		switch value := item.Value.(type) {
-		case map[string]*DescriptorEntity: // Reference, List
+		case []*DescriptorEntity: // Reference, List
 			if item.Type == "obj " {
-				sm.Add("Reference [Length: ", fmt.Sprint(len(items)), "]").NewLine()
+				sm.Add("Reference [Length: ", fmt.Sprint(len(value)), "]").NewLine()
 			} else {
-				sm.Add("List [Length: ", fmt.Sprint(len(items)), "]").NewLine()
+				sm.Add("List [Length: ", fmt.Sprint(len(value)), "]").NewLine()
 			}
 			sm.AddIndent(indent + 1).Add("{").NewLine()
 			sm.Add(stringList(value, indent+2))
 			sm.AddIndent(indent + 1).Add("}")
 		case *Descriptor:
 			sm.Add(value.string(indent + 1))
-		case float64, int32, bool:
+		case *DescriptorObjectArray:
+			sm.Add("Object array [Count: ", fmt.Sprint(value.Count), "] ", value.string(indent+1))
+		case float64, int32, int64, bool:
 			sm.Add(fmt.Sprint(value))
 		case *DescriptorUnitFloat:
 			sm.Add("[Type: ", value.Type, ", Value: ", fmt.Sprint(value.Value), "]")
+		case *DescriptorUnitFloats:
+			sm.Add("[Type: ", value.Type, ", Values: ", fmt.Sprint(value.Values), "]")
+		case *DescriptorPath:
+			sm.Add("[Signature: ", value.Signature, ", Path: ", value.Path, "]")
+		case []byte:
+			sm.Add("[Length: ", fmt.Sprint(len(value)), "]")
 		case string:
 			sm.Add(value)
 		case *DescriptorEnum:
@@ -419,6 +561,8 @@ func stringList(items map[string]*DescriptorEntity, indent int) string {
 			sm.Add("[Key: ", value.Key, " Name: ", value.Name, ", Class: ", value.Class, "]")
 		case *DescriptorOffset:
 			sm.Add("[Name: ", value.Name, ", Class: ", value.Class, " Value: ", fmt.Sprint(value.Value), "]")
+		case *DescriptorName:
+			sm.Add("[Name: ", value.Name, ", Class: ", value.Class, " Value: ", value.Value, "]")
 		case *DescriptorReferenceEnum:
 			sm.Add("[Type: ", value.Type, ", Enum: ", value.Enum, ", Class: ", value.Class, " Name: ", value.Name, "]")
 		default:
@@ -0,0 +1,240 @@
+package types
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"unicode/utf16"
+
+	"github.com/solovev/gopsd/util"
+)
+
+// Marshal encodes descriptor in the format read by NewDescriptor (descriptor version isn't included).
+func Marshal(d *Descriptor) ([]byte, error) {
+	writer := util.NewWriter()
+	if err := WriteDescriptor(writer, d); err != nil {
+		return nil, err
+	}
+	return writer.Bytes(), nil
+}
+
+// WriteDescriptor writes descriptor, so parsed descriptors are written byte-for-byte as they were read.
+// "alis", "Pth " and "tdta" items are written from their Raw data while their Value isn't changed.
+// Descriptors that weren't read completely (see Warnings) are written up to the unknown item
+// followed by its Raw data, i.e. up to the end of block they were read from.
+func WriteDescriptor(writer *util.Writer, d *Descriptor) error {
+	if d == nil {
+		return fmt.Errorf("Can't write nil descriptor")
+	}
+	return (&descriptorWriter{writer, d.stringIDs}).descriptor(d)
+}
+
+type descriptorWriter struct {
+	*util.Writer
+	stringIDs map[*string]bool
+}
+
+func (w *descriptorWriter) id(id *string) {
+	w.WriteDynamicString(*id, w.stringIDs[id])
+}
+
+func (w *descriptorWriter) descriptor(d *Descriptor) error {
+	w.WriteUnicodeString(d.Name)
+	w.id(&d.Class)
+	return w.list(d.Items, d.count, true)
+}
+
+// count writes number of items, which differs from length of truncated lists.
+func (w *descriptorWriter) count(items []*DescriptorEntity, count int32) {
+	if count == 0 {
+		count = int32(len(items))
+	}
+	w.WriteInt32(count)
+}
+
+func (w *descriptorWriter) list(items []*DescriptorEntity, count int32, keyed bool) error {
+	w.count(items, count)
+	for _, item := range items {
+		if keyed {
+			w.id(&item.Key)
+		}
+		w.WriteString(item.Type)
+		if err := w.value(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *descriptorWriter) value(item *DescriptorEntity) error {
+	ok := true
+	switch item.Type {
+	case "obj ":
+		var list []*DescriptorEntity
+		if list, ok = item.Value.([]*DescriptorEntity); ok {
+			return w.reference(list, item.count)
+		}
+	case "Objc", "GlbO":
+		var descriptor *Descriptor
+		if descriptor, ok = item.Value.(*Descriptor); ok {
+			return w.descriptor(descriptor)
+		}
+	case "ObAr":
+		var array *DescriptorObjectArray
+		if array, ok = item.Value.(*DescriptorObjectArray); ok {
+			w.WriteInt32(array.Count)
+			return w.descriptor(array.Descriptor)
+		}
+	case "VlLs":
+		var list []*DescriptorEntity
+		if list, ok = item.Value.([]*DescriptorEntity); ok {
+			return w.list(list, item.count, false)
+		}
+	case "doub":
+		var value float64
+		if value, ok = item.Value.(float64); ok {
+			w.WriteFloat64(value)
+		}
+	case "UntF":
+		var unit *DescriptorUnitFloat
+		if unit, ok = item.Value.(*DescriptorUnitFloat); ok {
+			w.WriteString(unit.Type)
+			w.WriteFloat64(unit.Value)
+		}
+	case "UnFl":
+		var unit *DescriptorUnitFloats
+		if unit, ok = item.Value.(*DescriptorUnitFloats); ok {
+			w.WriteString(unit.Type)
+			w.WriteInt32(int32(len(unit.Values)))
+			for _, value := range unit.Values {
+				w.WriteFloat64(value)
+			}
+		}
+	case "TEXT":
+		var value string
+		if value, ok = item.Value.(string); ok {
+			w.WriteUnicodeString(value)
+		}
+	case "enum":
+		var enum *DescriptorEnum
+		if enum, ok = item.Value.(*DescriptorEnum); ok {
+			w.id(&enum.Type)
+			w.id(&enum.Enum)
+		}
+	case "long":
+		var value int32
+		if value, ok = item.Value.(int32); ok {
+			w.WriteInt32(value)
+		}
+	case "comp":
+		var value int64
+		if value, ok = item.Value.(int64); ok {
+			w.WriteInt64(value)
+		}
+	case "bool":
+		var value bool
+		if value, ok = item.Value.(bool); ok {
+			w.WriteBool(value)
+		}
+	case "type", "GlbC":
+		var class *DescriptorClass
+		if class, ok = item.Value.(*DescriptorClass); ok {
+			w.WriteUnicodeString(class.Name)
+			w.id(&class.Class)
+		}
+	case "alis", "Pth ", "tdta":
+		raw := []byte(item.Raw)
+		if !rawMatches(item) {
+			switch value := item.Value.(type) {
+			case []byte:
+				raw = value
+			case string:
+				raw = []byte(value)
+			case *DescriptorPath:
+				raw = encodeDescriptorPath(value)
+			default:
+				ok = false
+			}
+		}
+		if ok {
+			w.WriteInt32(int32(len(raw)))
+			w.WriteBytes(raw)
+		}
+	default:
+		if item.Value != nil || item.Raw == "" {
+			return fmt.Errorf("Can't write item \"%s\" of unknown type [%s]", item.Key, item.Type)
+		}
+		w.WriteString(item.Raw)
+	}
+	if !ok {
+		return fmt.Errorf("Can't write value %T as [%s] item \"%s\"", item.Value, item.Type, item.Key)
+	}
+	return nil
+}
+
+func (w *descriptorWriter) reference(items []*DescriptorEntity, count int32) error {
+	w.count(items, count)
+	for _, item := range items {
+		w.WriteString(item.Type)
+		switch value := item.Value.(type) {
+		case *DescriptorProperty:
+			w.WriteUnicodeString(value.Name)
+			w.id(&value.Class)
+			w.id(&value.Key)
+		case *DescriptorClass:
+			w.WriteUnicodeString(value.Name)
+			w.id(&value.Class)
+		case *DescriptorReferenceEnum:
+			w.WriteUnicodeString(value.Name)
+			w.id(&value.Class)
+			w.id(&value.Type)
+			w.id(&value.Enum)
+		case *DescriptorOffset:
+			w.WriteUnicodeString(value.Name)
+			w.id(&value.Class)
+			w.WriteInt32(value.Value)
+		case *DescriptorName:
+			w.WriteUnicodeString(value.Name)
+			w.id(&value.Class)
+			w.WriteUnicodeString(value.Value)
+		case nil:
+			if item.Raw == "" {
+				return fmt.Errorf("Can't write reference of unknown type [%s]", item.Type)
+			}
+			w.WriteString(item.Raw)
+		default:
+			return fmt.Errorf("Can't write value %T as [%s] reference", item.Value, item.Type)
+		}
+	}
+	return nil
+}
+
+// rawMatches reports whether Raw data of "alis", "Pth " or "tdta" item still decodes to its Value.
+func rawMatches(item *DescriptorEntity) bool {
+	if item.Raw == "" {
+		return false
+	}
+	switch value := item.Value.(type) {
+	case []byte:
+		return string(value) == item.Raw
+	case *DescriptorPath:
+		return value != nil && *value == *newDescriptorPath([]byte(item.Raw))
+	case string:
+		return value == item.Raw
+	}
+	value, err := ParseEngineData([]byte(item.Raw))
+	return err == nil && reflect.DeepEqual(value, item.Value)
+}
+
+// encodeDescriptorPath encodes "Pth " item: signature, little endian size and length and UTF-16 path.
+func encodeDescriptorPath(path *DescriptorPath) []byte {
+	chars := utf16.Encode([]rune(path.Path))
+	b := make([]byte, 12+2*len(chars))
+	copy(b, path.Signature)
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(b)))
+	binary.LittleEndian.PutUint32(b[8:], uint32(len(chars)))
+	for i, char := range chars {
+		binary.LittleEndian.PutUint16(b[12+2*i:], char)
+	}
+	return b
+}
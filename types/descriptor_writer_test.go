@@ -0,0 +1,145 @@
+package types
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/solovev/gopsd/util"
+)
+
+// descriptorBuilder writes descriptor data for tests.
+type descriptorBuilder struct {
+	bytes.Buffer
+}
+
+func (b *descriptorBuilder) int32(v int32) *descriptorBuilder {
+	binary.Write(b, binary.BigEndian, v)
+	return b
+}
+
+func (b *descriptorBuilder) float64(v float64) *descriptorBuilder {
+	binary.Write(b, binary.BigEndian, v)
+	return b
+}
+
+func (b *descriptorBuilder) raw(s string) *descriptorBuilder {
+	b.WriteString(s)
+	return b
+}
+
+// code writes 4-character ID with zero length.
+func (b *descriptorBuilder) code(id string) *descriptorBuilder {
+	return b.int32(0).raw(id)
+}
+
+// id writes ID as string with its length.
+func (b *descriptorBuilder) id(id string) *descriptorBuilder {
+	return b.int32(int32(len(id))).raw(id)
+}
+
+func (b *descriptorBuilder) unicode(s string) *descriptorBuilder {
+	chars := utf16.Encode([]rune(s))
+	b.int32(int32(len(chars)))
+	binary.Write(b, binary.BigEndian, chars)
+	return b
+}
+
+func (b *descriptorBuilder) data(s string) *descriptorBuilder {
+	return b.int32(int32(len(s))).raw(s)
+}
+
+const testEngineData = "\n\n<<\n\t/EngineDict\n\t<<\n\t\t/Editor\n\t\t<<\n\t\t\t/Text (\xfe\xff\x00h\x00i)\n\t\t>>\n\t>>\n>>"
+
+// nestedDescriptor returns data of descriptor used as "Objc" item.
+func nestedDescriptor() []byte {
+	b := new(descriptorBuilder)
+	b.unicode("").id("Clr ").int32(2)
+	b.code("Rd  ").raw("doub").float64(255)
+	b.id("null").raw("enum").code("Type").id("Enum") // "null" is a string here, unlike in the root
+	return b.Bytes()
+}
+
+func testDescriptor() []byte {
+	b := new(descriptorBuilder)
+	b.unicode("Name").code("null").int32(10)
+	b.code("Opct").raw("UntF").raw("#Prc").float64(50)
+	b.id("longKey").raw("long").int32(-7)
+	b.code("cmp ").raw("comp").int32(1).int32(2)
+	b.code("Txt ").raw("TEXT").unicode("Text")
+	b.code("bool").raw("bool").raw("\x01")
+	b.code("Clrs").raw("VlLs").int32(2).raw("long").int32(1).raw("type").unicode("").code("Clss")
+	b.code("Clr ").raw("Objc").raw(string(nestedDescriptor()))
+	b.code("null").raw("obj ").int32(2).raw("prop").unicode("").code("Lyr ").id("Key1").raw("Idnt").unicode("").code("Lyr ").int32(3)
+	b.code("alis").raw("alis").data("alias data")
+	b.code("EngD").raw("tdta").data(testEngineData)
+	return b.Bytes()
+}
+
+func TestDescriptorRoundTrip(t *testing.T) {
+	data := testDescriptor()
+	d := NewDescriptor(util.NewReader(data))
+	if len(d.Warnings) > 0 {
+		t.Fatalf("warnings: %v", d.Warnings)
+	}
+	out, err := Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Errorf("Marshal(NewDescriptor(x)) != x:\n%q\n%q", out, data)
+	}
+
+	nested, _ := d.item("Clr ").Value.(*Descriptor)
+	out, err = Marshal(nested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, nestedDescriptor()) {
+		t.Errorf("nested descriptor isn't written as read:\n%q\n%q", out, nestedDescriptor())
+	}
+}
+
+func TestDescriptorRoundTripUnknownType(t *testing.T) {
+	b := new(descriptorBuilder)
+	b.unicode("").code("null").int32(2)
+	b.code("list").raw("VlLs").int32(3).raw("long").int32(1).raw("WHAT").int32(7).raw("tail")
+	data := b.Bytes()
+
+	d := NewDescriptor(util.NewReader(data))
+	if len(d.Warnings) != 1 {
+		t.Errorf("got warnings %v, want one", d.Warnings)
+	}
+	out, err := Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Errorf("truncated descriptor isn't written as read:\n%q\n%q", out, data)
+	}
+}
+
+func TestDescriptorWriteChangedRawItems(t *testing.T) {
+	d := NewDescriptor(util.NewReader(testDescriptor()))
+	alias := d.item("alis")
+	alias.Value = []byte("changed")
+	text := d.item("EngD")
+	text.Value = "new data"
+
+	out, err := Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tail := new(descriptorBuilder)
+	tail.code("alis").raw("alis").data("changed")
+	tail.code("EngD").raw("tdta").data("new data")
+	if !bytes.HasSuffix(out, tail.Bytes()) {
+		t.Errorf("changed values aren't written: %q", out)
+	}
+
+	text.Value = map[string]interface{}{}
+	if _, err := Marshal(d); err == nil {
+		t.Error("changed engine data is written without error")
+	}
+}
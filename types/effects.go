@@ -2,7 +2,10 @@ package types
 
 import "github.com/solovev/gopsd/util"
 
+// ObsoleteEffects stores effects of "lrFX" block (Photoshop 5.x).
+// Use LayerEffects to access them the same way as modern ones.
 type ObsoleteEffects struct {
+	Visible     bool // Common state ("cmnS")
 	DropShadow  *ShadowEffect
 	InnerShadow *ShadowEffect
 	OuterGlow   *GlowEffect
@@ -13,16 +16,20 @@ type ObsoleteEffects struct {
 
 func ReadObsoleteEffects(reader *util.Reader) *ObsoleteEffects {
 	effects := new(ObsoleteEffects)
+	effects.Visible = true
 	reader.Skip(2) // Version (= 0)
 	nEffects := int(reader.ReadInt16())
 	for i := 0; i < nEffects; i++ {
 		reader.Skip(4) // Signature (= "8BIM")
 		id := reader.ReadString(4)
+		length := int(reader.ReadInt32())
+		pos := reader.Position
+
 		switch id {
 		case "cmnS":
-			reader.Skip(reader.ReadInt32())
+			reader.Skip(4) // Version (= 0)
+			effects.Visible = reader.ReadByte() == 1
 		case "dsdw", "isdw":
-			reader.Skip(4)                // Length (41 or 51)
 			version := reader.ReadInt32() // Version (0 for PS 5.0 or 2 for 5.5)
 
 			shadow := new(ShadowEffect)
@@ -47,7 +54,6 @@ func ReadObsoleteEffects(reader *util.Reader) *ObsoleteEffects {
 				effects.InnerShadow = shadow
 			}
 		case "oglw", "iglw":
-			reader.Skip(4) // Length
 			version := reader.ReadInt32()
 
 			glow := new(GlowEffect)
@@ -72,7 +78,6 @@ func ReadObsoleteEffects(reader *util.Reader) *ObsoleteEffects {
 				effects.InnerGlow = glow
 			}
 		case "bevl":
-			reader.Skip(4) // Length
 			version := reader.ReadInt32()
 
 			bevel := new(BevelEffect)
@@ -101,10 +106,10 @@ func ReadObsoleteEffects(reader *util.Reader) *ObsoleteEffects {
 			}
 			effects.Bevel = bevel
 		case "sofi":
-			reader.Skip(4) // Length
 			reader.Skip(4) // Version (= 2)
 
 			fill := new(SolidFillEffect)
+			reader.Skip(4) // Blend mode signature
 			fill.BlendMode = reader.ReadString(4)
 			fill.ColorSpace = reader.ReadInt16()
 			fill.Color = NewRGBAColor(reader)
@@ -115,10 +120,116 @@ func ReadObsoleteEffects(reader *util.Reader) *ObsoleteEffects {
 
 			effects.SolidFill = fill
 		}
+		reader.Skip(pos + length - reader.Position)
+	}
+	return effects
+}
+
+// LayerEffects converts obsolete effects to the modern model.
+// Global angle (image resource 1037) is used by effects with "Use global angle" set.
+func (e *ObsoleteEffects) LayerEffects(globalAngle float64) *LayerEffects {
+	effects := new(LayerEffects)
+	effects.Enabled = e.Visible
+	effects.Scale = 100
+
+	if e.DropShadow != nil {
+		effects.DropShadows = append(effects.DropShadows, &DropShadow{e.DropShadow.shadow(globalAngle), true})
+	}
+	if e.InnerShadow != nil {
+		effects.InnerShadows = append(effects.InnerShadows, &InnerShadow{e.InnerShadow.shadow(globalAngle)})
+	}
+	if e.OuterGlow != nil {
+		effects.OuterGlow = &OuterGlow{e.OuterGlow.glow()}
+	}
+	if e.InnerGlow != nil {
+		effects.InnerGlow = &InnerGlow{e.InnerGlow.glow(), "Edge"}
+	}
+	if e.Bevel != nil {
+		effects.BevelEmboss = e.Bevel.bevelEmboss(globalAngle)
+	}
+	if e.SolidFill != nil {
+		fill := e.SolidFill
+		effects.ColorOverlays = append(effects.ColorOverlays, &ColorOverlay{
+			Effect:    Effect{fill.Enabled, true, true},
+			BlendMode: obsoleteBlendMode(fill.BlendMode),
+			Color:     fill.Color.NRGBA(fill.ColorSpace),
+			Opacity:   obsoleteOpacity(fill.Opacity),
+		})
 	}
 	return effects
 }
 
+func obsoleteBlendMode(key string) string {
+	if mode, ok := util.BlendModeKeys[key]; ok {
+		return mode
+	}
+	return key
+}
+
+func obsoleteOpacity(value byte) float64 {
+	return float64(value) / 255 * 100
+}
+
+// fixed converts 16.16 fixed point number.
+func fixed(value int32) float64 {
+	return float64(value) / 65536
+}
+
+func (s *ShadowEffect) shadow(globalAngle float64) Shadow {
+	shadow := Shadow{Effect: Effect{s.Enabled, true, true}}
+	shadow.BlendMode = obsoleteBlendMode(s.BlendMode)
+	shadow.Color = s.Color.NRGBA(s.ColorSpace)
+	shadow.Opacity = obsoleteOpacity(s.Opacity)
+	shadow.UseGlobalLight = s.SharedEffectAngle
+	shadow.LocalAngle = fixed(s.Angle)
+	shadow.Angle = shadow.LocalAngle
+	if shadow.UseGlobalLight {
+		shadow.Angle = globalAngle
+	}
+	shadow.Distance = fixed(s.Distance)
+	shadow.Spread = fixed(s.Intensity)
+	shadow.Size = fixed(s.Blur)
+	return shadow
+}
+
+func (g *GlowEffect) glow() Glow {
+	glow := Glow{Effect: Effect{g.Enabled, true, true}}
+	glow.BlendMode = obsoleteBlendMode(g.BlendMode)
+	glow.Color = g.Color.NRGBA(g.ColorSpace)
+	glow.Opacity = obsoleteOpacity(g.Opacity)
+	glow.Technique = "Softer"
+	glow.Spread = fixed(g.Intensity)
+	glow.Size = fixed(g.Blur)
+	glow.Range = 50
+	return glow
+}
+
+var obsoleteBevelStyles = map[byte]string{1: "Outer bevel", 2: "Inner bevel", 3: "Emboss", 4: "Pillow emboss", 5: "Stroke emboss"}
+
+func (b *BevelEffect) bevelEmboss(globalAngle float64) *BevelEmboss {
+	bevel := &BevelEmboss{Effect: Effect{b.Enabled, true, true}}
+	bevel.Style = obsoleteBevelStyles[b.BevelStyle]
+	bevel.Technique = "Smooth"
+	bevel.Up = b.Up
+	bevel.Depth = fixed(b.Strength)
+	bevel.Size = fixed(b.Blur)
+	bevel.UseGlobalLight = b.SharedEffectAngle
+	bevel.LocalAngle = fixed(b.Angle)
+	bevel.Angle = bevel.LocalAngle
+	if bevel.UseGlobalLight {
+		bevel.Angle = globalAngle
+	}
+	bevel.Altitude, bevel.LocalAltitude = 30, 30
+	bevel.HighlightBlendMode = obsoleteBlendMode(b.HighlightBlendMode)
+	bevel.HighlightColor = b.HighlightColor.NRGBA(b.HighlightColorSpace)
+	bevel.HighlightOpacity = obsoleteOpacity(b.HighlightOpacity)
+	bevel.ShadowBlendMode = obsoleteBlendMode(b.ShadowBlendMode)
+	bevel.ShadowColor = b.ShadowColor.NRGBA(b.ShadowColorSpace)
+	bevel.ShadowOpacity = obsoleteOpacity(b.ShadowOpacity)
+	return bevel
+}
+
+// Sizes and angles of obsolete effects are 16.16 fixed point numbers, opacities are in range [0, 255].
 type ShadowEffect struct {
 	Blur, Intensity, Angle, Distance int32
 	ColorSpace, NativeColorSpace     int16
@@ -0,0 +1,519 @@
+package types
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/solovev/gopsd/util"
+)
+
+// EngineName is a name value of engine data ("/Name" used as value, not as key).
+type EngineName string
+
+// ParseEngineData parses text engine data ("tdta" items, e.g. "EngineData" of text descriptor).
+// Dictionaries are parsed as map[string]interface{}, arrays as []interface{}, strings as string,
+// hex strings as []byte, names as EngineName, numbers as float64.
+func ParseEngineData(data []byte) (interface{}, error) {
+	p := &engineParser{data: data}
+	value, err := p.value(p.next(), 0)
+	if err != nil {
+		return nil, err
+	}
+	if token := p.next(); token.kind != tokenEnd {
+		return nil, p.errorf(token, "unexpected %s after value", token)
+	}
+	return value, nil
+}
+
+type engineTokenKind int
+
+const (
+	tokenEnd engineTokenKind = iota
+	tokenError
+	tokenDictStart
+	tokenDictEnd
+	tokenArrayStart
+	tokenArrayEnd
+	tokenName
+	tokenString
+	tokenHexString
+	tokenNumber
+	tokenKeyword
+)
+
+type engineToken struct {
+	kind  engineTokenKind
+	text  []byte // Content of names, strings, numbers and keywords
+	pos   int
+	error string
+}
+
+func (t engineToken) String() string {
+	switch t.kind {
+	case tokenEnd:
+		return "end of data"
+	case tokenDictStart:
+		return "\"<<\""
+	case tokenDictEnd:
+		return "\">>\""
+	case tokenArrayStart:
+		return "\"[\""
+	case tokenArrayEnd:
+		return "\"]\""
+	case tokenName:
+		return "name \"/" + string(t.text) + "\""
+	case tokenString, tokenHexString:
+		return "string"
+	}
+	return "\"" + string(t.text) + "\""
+}
+
+// engineParser is a tokenizer and parser of PostScript-like engine data.
+type engineParser struct {
+	data []byte
+	pos  int
+}
+
+const engineMaxDepth = 256
+
+func (p *engineParser) errorf(token engineToken, format string, args ...interface{}) error {
+	if token.kind == tokenError {
+		return fmt.Errorf("Engine data: %s at %d", token.error, token.pos)
+	}
+	return fmt.Errorf("Engine data: "+format+" at %d", append(args, token.pos)...)
+}
+
+func isEngineWhitespace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0
+}
+
+func isEngineDelimiter(c byte) bool {
+	switch c {
+	case '/', '[', ']', '<', '>', '(', ')':
+		return true
+	}
+	return isEngineWhitespace(c)
+}
+
+func (p *engineParser) next() engineToken {
+	for p.pos < len(p.data) && isEngineWhitespace(p.data[p.pos]) {
+		p.pos++
+	}
+	token := engineToken{pos: p.pos}
+	if p.pos >= len(p.data) {
+		return token
+	}
+
+	c := p.data[p.pos]
+	switch {
+	case c == '<' && p.peek(1) == '<':
+		p.pos += 2
+		token.kind = tokenDictStart
+	case c == '>' && p.peek(1) == '>':
+		p.pos += 2
+		token.kind = tokenDictEnd
+	case c == '[':
+		p.pos++
+		token.kind = tokenArrayStart
+	case c == ']':
+		p.pos++
+		token.kind = tokenArrayEnd
+	case c == '/':
+		p.pos++
+		token.kind = tokenName
+		token.text = p.word()
+	case c == '(':
+		return p.string()
+	case c == '<':
+		return p.hexString()
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		token.kind = tokenNumber
+		token.text = p.word()
+	case !isEngineDelimiter(c):
+		token.kind = tokenKeyword
+		token.text = p.word()
+	default:
+		p.pos++
+		token.kind = tokenError
+		token.error = fmt.Sprintf("unexpected character %q", c)
+	}
+	return token
+}
+
+func (p *engineParser) peek(offset int) byte {
+	if p.pos+offset < len(p.data) {
+		return p.data[p.pos+offset]
+	}
+	return 0
+}
+
+// word reads characters up to delimiter.
+func (p *engineParser) word() []byte {
+	start := p.pos
+	for p.pos < len(p.data) && !isEngineDelimiter(p.data[p.pos]) {
+		p.pos++
+	}
+	return p.data[start:p.pos]
+}
+
+// string reads string in parentheses. Special characters are escaped by backslash.
+func (p *engineParser) string() engineToken {
+	token := engineToken{kind: tokenString, pos: p.pos}
+	p.pos++ // "("
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		p.pos++
+		switch c {
+		case ')':
+			return token
+		case '\\':
+			if p.pos < len(p.data) {
+				token.text = append(token.text, p.data[p.pos])
+				p.pos++
+			}
+		default:
+			token.text = append(token.text, c)
+		}
+	}
+	token.kind = tokenError
+	token.error = "unterminated string"
+	return token
+}
+
+func (p *engineParser) hexString() engineToken {
+	token := engineToken{kind: tokenHexString, pos: p.pos}
+	p.pos++ // "<"
+	var digits []byte
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		p.pos++
+		if c == '>' {
+			if len(digits)%2 == 1 {
+				digits = append(digits, '0')
+			}
+			text, err := hex.DecodeString(string(digits))
+			if err != nil {
+				token.kind = tokenError
+				token.error = "wrong hex string"
+			}
+			token.text = text
+			return token
+		}
+		if !isEngineWhitespace(c) {
+			digits = append(digits, c)
+		}
+	}
+	token.kind = tokenError
+	token.error = "unterminated hex string"
+	return token
+}
+
+func (p *engineParser) value(token engineToken, depth int) (interface{}, error) {
+	if depth > engineMaxDepth {
+		return nil, p.errorf(token, "too deep nesting")
+	}
+	switch token.kind {
+	case tokenDictStart:
+		dict := make(map[string]interface{})
+		for {
+			key := p.next()
+			if key.kind == tokenDictEnd {
+				return dict, nil
+			}
+			if key.kind != tokenName {
+				return nil, p.errorf(key, "expected name of dictionary key, got %s", key)
+			}
+			value, err := p.value(p.next(), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			dict[string(key.text)] = value
+		}
+	case tokenArrayStart:
+		list := make([]interface{}, 0)
+		for {
+			item := p.next()
+			if item.kind == tokenArrayEnd {
+				return list, nil
+			}
+			value, err := p.value(item, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+	case tokenName:
+		return EngineName(token.text), nil
+	case tokenString:
+		return decodeEngineString(token.text), nil
+	case tokenHexString:
+		return token.text, nil
+	case tokenNumber:
+		value, err := strconv.ParseFloat(string(token.text), 64)
+		if err != nil {
+			return nil, p.errorf(token, "wrong number %s", token)
+		}
+		return value, nil
+	case tokenKeyword:
+		switch string(token.text) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return nil, p.errorf(token, "unknown keyword %s", token)
+	}
+	return nil, p.errorf(token, "unexpected %s", token)
+}
+
+// decodeEngineString decodes UTF-16 string with byte order mark, other strings are kept as is.
+func decodeEngineString(b []byte) string {
+	if len(b) >= 2 && b[0] == 0xFE && b[1] == 0xFF {
+		return util.BytesToUTF16(b[2:], binary.BigEndian)
+	}
+	return string(b)
+}
+
+// EngineData is typed model of text engine data of type tool.
+type EngineData struct {
+	EngineDict        *EngineDict
+	ResourceDict      *ResourceDict
+	DocumentResources *ResourceDict
+
+	raw map[string]interface{}
+}
+
+// NewEngineData builds typed model from parsed engine data (see ParseEngineData).
+func NewEngineData(value interface{}) *EngineData {
+	data := new(EngineData)
+	if raw, ok := value.(map[string]interface{}); ok {
+		data.raw = raw
+		decodeEngineValue(raw, reflect.ValueOf(data).Elem())
+	}
+	return data
+}
+
+// EngineDict stores text and its style and paragraph runs. Run lengths are in UTF-16 code units of text.
+type EngineDict struct {
+	Editor struct {
+		Text string // Paragraphs are separated by "\r"
+	}
+	ParagraphRun             *ParagraphRun
+	StyleRun                 *StyleRun
+	AntiAlias                int
+	UseFractionalGlyphWidths bool
+	Rendered                 *TextRendered
+}
+
+// TextRendered stores text frames.
+type TextRendered struct {
+	Version int
+	Shapes  struct {
+		WritingDirection int
+		Children         []*TextShape
+	}
+}
+
+// TextShape is a frame of text. ShapeType is 0 for point text and 1 for paragraph (box) text.
+type TextShape struct {
+	ShapeType  int
+	Procession int
+	Cookie     struct {
+		Photoshop struct {
+			ShapeType int
+			PointBase []float64 // Origin of point text
+			BoxBounds []float64 // Left, top, right and bottom of paragraph text box
+		}
+	}
+}
+
+type ParagraphRun struct {
+	DefaultRunData *ParagraphRunData
+	RunArray       []*ParagraphRunData
+	RunLengthArray []int
+	IsJoinable     int
+}
+
+type ParagraphRunData struct {
+	ParagraphSheet *ParagraphSheet
+	Adjustments    struct {
+		Axis, XY []float64
+	}
+}
+
+type StyleRun struct {
+	DefaultRunData *StyleRunData
+	RunArray       []*StyleRunData
+	RunLengthArray []int
+	IsJoinable     int
+}
+
+type StyleRunData struct {
+	StyleSheet *StyleSheet
+}
+
+// ResourceDict stores fonts and style sheets referenced by index from runs.
+type ResourceDict struct {
+	FontSet                 []*Font
+	StyleSheetSet           []*StyleSheet
+	ParagraphSheetSet       []*ParagraphSheet
+	TheNormalStyleSheet     int
+	TheNormalParagraphSheet int
+
+	SuperscriptSize, SuperscriptPosition float64
+	SubscriptSize, SubscriptPosition     float64
+	SmallCapSize                         float64
+}
+
+type Font struct {
+	Name      string // PostScript name
+	Script    int
+	FontType  int
+	Synthetic int
+}
+
+type StyleSheet struct {
+	Name           string
+	StyleSheetData *StyleSheetData
+}
+
+// StyleSheetData stores character style. Styles of runs contain only changed properties.
+type StyleSheetData struct {
+	Font              int // Index in FontSet
+	FontSize          float64
+	FauxBold          bool
+	FauxItalic        bool
+	AutoLeading       bool
+	Leading           float64
+	HorizontalScale   float64
+	VerticalScale     float64
+	Tracking          float64 // Thousandths of em
+	AutoKerning       bool
+	Kerning           float64
+	BaselineShift     float64
+	FontCaps          int // 0 = normal, 1 = small caps, 2 = all caps
+	FontBaseline      int // 0 = normal, 1 = superscript, 2 = subscript
+	Underline         bool
+	Strikethrough     bool
+	Ligatures         bool
+	DLigatures        bool
+	BaselineDirection int
+	Tsume             float64
+	StyleRunAlignment int
+	Language          int
+	NoBreak           bool
+	FillColor         *EngineColor
+	StrokeColor       *EngineColor
+	FillFlag          bool
+	StrokeFlag        bool
+	FillFirst         bool
+	OutlineWidth      float64
+}
+
+// EngineColor stores color values in range [0, 1]. Type 1 is ARGB.
+type EngineColor struct {
+	Type   int
+	Values []float64
+}
+
+type ParagraphSheet struct {
+	Name              string
+	DefaultStyleSheet int // Index in StyleSheetSet
+	Properties        *ParagraphProperties
+}
+
+// ParagraphProperties stores paragraph style. Styles of runs contain only changed properties.
+type ParagraphProperties struct {
+	Justification      int // 0 = left, 1 = right, 2 = center, 3-5 = justify last line left/right/center, 6 = justify all
+	FirstLineIndent    float64
+	StartIndent        float64
+	EndIndent          float64
+	SpaceBefore        float64
+	SpaceAfter         float64
+	AutoHyphenate      bool
+	HyphenatedWordSize int
+	PreHyphen          int
+	PostHyphen         int
+	ConsecutiveHyphens int
+	Zone               float64
+	WordSpacing        []float64
+	LetterSpacing      []float64
+	GlyphSpacing       []float64
+	AutoLeading        float64
+	LeadingType        int
+	Hanging            bool
+	Burasagari         bool
+	KinsokuOrder       int
+	EveryLineComposer  bool
+}
+
+// decodeEngineValue decodes parsed engine data into value. Struct fields are matched with
+// dictionary keys by name (or "engine" tag). Only present keys are decoded, values of
+// unexpected types are ignored.
+func decodeEngineValue(source interface{}, value reflect.Value) {
+	if source == nil {
+		return
+	}
+	switch value.Kind() {
+	case reflect.Ptr:
+		if value.IsNil() {
+			value.Set(reflect.New(value.Type().Elem()))
+		}
+		decodeEngineValue(source, value.Elem())
+	case reflect.Interface:
+		value.Set(reflect.ValueOf(source))
+	case reflect.Struct:
+		dict, ok := source.(map[string]interface{})
+		if !ok {
+			return
+		}
+		t := value.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			key := field.Name
+			if tag := field.Tag.Get("engine"); tag != "" {
+				key = tag
+			}
+			if item, ok := dict[key]; ok {
+				decodeEngineValue(item, value.Field(i))
+			}
+		}
+	case reflect.Slice:
+		if b, ok := source.([]byte); ok && value.Type().Elem().Kind() == reflect.Uint8 {
+			value.SetBytes(b)
+			return
+		}
+		list, ok := source.([]interface{})
+		if !ok {
+			return
+		}
+		result := reflect.MakeSlice(value.Type(), len(list), len(list))
+		for i, item := range list {
+			decodeEngineValue(item, result.Index(i))
+		}
+		value.Set(result)
+	case reflect.String:
+		switch s := source.(type) {
+		case string:
+			value.SetString(s)
+		case EngineName:
+			value.SetString(string(s))
+		}
+	case reflect.Bool:
+		if b, ok := source.(bool); ok {
+			value.SetBool(b)
+		}
+	default:
+		if number, ok := source.(float64); ok && isNumber(value.Kind()) {
+			setNumber(value, number)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEngineTokenizer(t *testing.T) {
+	p := &engineParser{data: []byte("<< /Key -1.5 .25 1e3 -2E-2 (a\\)b) <48 69 7> /Name [ true ] >>")}
+	want := []struct {
+		kind engineTokenKind
+		text string
+	}{
+		{tokenDictStart, ""},
+		{tokenName, "Key"},
+		{tokenNumber, "-1.5"},
+		{tokenNumber, ".25"},
+		{tokenNumber, "1e3"},
+		{tokenNumber, "-2E-2"},
+		{tokenString, "a)b"},
+		{tokenHexString, "Hip"},
+		{tokenName, "Name"},
+		{tokenArrayStart, ""},
+		{tokenKeyword, "true"},
+		{tokenArrayEnd, ""},
+		{tokenDictEnd, ""},
+		{tokenEnd, ""},
+	}
+	for i, w := range want {
+		token := p.next()
+		if token.kind != w.kind || string(token.text) != w.text {
+			t.Errorf("token %d: got %v %q, want %v %q", i, token.kind, token.text, w.kind, w.text)
+		}
+	}
+}
+
+func TestParseEngineData(t *testing.T) {
+	data := "<<\n\t/Numbers [ -1 -0.5 1.5e2 -2E-1 .5 ]" +
+		"\n\t/Text (\xfe\xff\x00h\x04\x10\x00\\)\x00\\\\)" +
+		"\n\t/Plain (abc)" +
+		"\n\t/Hex <FEFF0041>" +
+		"\n\t/Name /Value" +
+		"\n\t/Names [ /A /B ]" +
+		"\n\t/Nested << /Name /Key /Bool false /Null null >>" +
+		"\n>>"
+	value, err := ParseEngineData([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"Numbers": []interface{}{-1.0, -0.5, 150.0, -0.2, 0.5},
+		"Text":    "hА)\\",
+		"Plain":   "abc",
+		"Hex":     []byte{0xFE, 0xFF, 0x00, 0x41},
+		"Name":    EngineName("Value"),
+		"Names":   []interface{}{EngineName("A"), EngineName("B")},
+		"Nested":  map[string]interface{}{"Name": EngineName("Key"), "Bool": false, "Null": nil},
+	}
+	if !reflect.DeepEqual(value, want) {
+		t.Errorf("got %#v, want %#v", value, want)
+	}
+}
+
+func TestParseEngineDataErrors(t *testing.T) {
+	for _, data := range []string{
+		"<< (key) 1 >>",   // Key isn't a name
+		"<< /Key 1",       // Unterminated dictionary
+		"<< /Key (a >>",   // Unterminated string
+		"<< /Key <4G> >>", // Wrong hex string
+		"<< /Key 1-2 >>",  // Wrong number
+		"<< /Key nil >>",  // Unknown keyword
+		"<< >> >>",        // Data after value
+	} {
+		if _, err := ParseEngineData([]byte(data)); err == nil {
+			t.Errorf("no error for %q", data)
+		}
+	}
+}
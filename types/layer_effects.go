@@ -0,0 +1,483 @@
+package types
+
+import (
+	"image/color"
+
+	"github.com/solovev/gopsd/util"
+)
+
+// LayerEffects stores layer style built from "lfx2" or "lmfx" descriptor.
+// Effects that can be applied several times (shadows, overlays, strokes) are lists,
+// ordered as in Photoshop's Layer Style dialog.
+type LayerEffects struct {
+	Descriptor *Descriptor
+	Enabled    bool    // "masterFXSwitch", effects are visible
+	Scale      float64 // Percent
+
+	DropShadows      []*DropShadow
+	InnerShadows     []*InnerShadow
+	OuterGlow        *OuterGlow
+	InnerGlow        *InnerGlow
+	BevelEmboss      *BevelEmboss
+	Satin            *Satin
+	ColorOverlays    []*ColorOverlay
+	GradientOverlays []*GradientOverlay
+	PatternOverlay   *PatternOverlay
+	Strokes          []*Stroke
+}
+
+// Effect stores flags common to all effects.
+type Effect struct {
+	Enabled, Present, ShowInDialog bool
+}
+
+// Shadow stores parameters common to drop and inner shadows. Sizes are in pixels.
+type Shadow struct {
+	Effect
+	BlendMode string
+	Color     color.NRGBA
+	Opacity   float64 // Percent
+
+	UseGlobalLight bool
+	Angle          float64 // Degrees, resolved through global light if used
+	LocalAngle     float64 // Degrees, as stored in layer
+
+	Distance  float64
+	Spread    float64 // Percent ("Choke" for inner shadow)
+	Size      float64
+	Noise     float64 // Percent
+	AntiAlias bool
+	Contour   *Contour
+}
+
+type DropShadow struct {
+	Shadow
+	LayerKnocksOut bool
+}
+
+type InnerShadow struct {
+	Shadow
+}
+
+// Glow stores parameters common to outer and inner glows. Sizes are in pixels.
+type Glow struct {
+	Effect
+	BlendMode string
+	Color     color.NRGBA
+	Gradient  *Gradient // Not nil if glow is filled with gradient instead of Color
+	Opacity   float64   // Percent
+
+	Technique string  // "Softer" or "Precise"
+	Spread    float64 // Percent ("Choke" for inner glow)
+	Size      float64
+	Noise     float64 // Percent
+	Jitter    float64 // Percent
+	Range     float64 // Percent
+	AntiAlias bool
+	Contour   *Contour
+}
+
+type OuterGlow struct {
+	Glow
+}
+
+type InnerGlow struct {
+	Glow
+	Source string // "Center" or "Edge"
+}
+
+type BevelEmboss struct {
+	Effect
+	Style     string // "Outer bevel", "Inner bevel", "Emboss", "Pillow emboss" or "Stroke emboss"
+	Technique string // "Smooth", "Chisel hard" or "Chisel soft"
+	Up        bool   // Direction
+	Depth     float64
+	Size      float64
+	Soften    float64
+
+	UseGlobalLight     bool
+	Angle, LocalAngle  float64
+	Altitude           float64
+	LocalAltitude      float64
+	GlossContour       *Contour
+	AntiAliasGloss     bool
+	HighlightBlendMode string
+	HighlightColor     color.NRGBA
+	HighlightOpacity   float64
+	ShadowBlendMode    string
+	ShadowColor        color.NRGBA
+	ShadowOpacity      float64
+
+	UseShape, UseTexture bool
+}
+
+type Satin struct {
+	Effect
+	BlendMode string
+	Color     color.NRGBA
+	Opacity   float64
+	Angle     float64
+	Distance  float64
+	Size      float64
+	Invert    bool
+	AntiAlias bool
+	Contour   *Contour
+}
+
+type ColorOverlay struct {
+	Effect
+	BlendMode string
+	Color     color.NRGBA
+	Opacity   float64
+}
+
+type GradientOverlay struct {
+	Effect
+	BlendMode string
+	Opacity   float64
+	GradientFill
+}
+
+type PatternOverlay struct {
+	Effect
+	BlendMode string
+	Opacity   float64
+	PatternFill
+}
+
+type Stroke struct {
+	Effect
+	BlendMode string
+	Opacity   float64
+	Position  string // "Outside", "Inside" or "Center"
+	FillType  string // "Color", "Gradient" or "Pattern"
+	Size      float64
+
+	Color    color.NRGBA
+	Gradient *GradientFill
+	Pattern  *PatternFill
+}
+
+// GradientFill stores gradient and its placement.
+type GradientFill struct {
+	Gradient       *Gradient
+	Style          string  // "Linear", "Radial", "Angle", "Reflected" or "Diamond"
+	Angle          float64 // Degrees
+	Scale          float64 // Percent
+	Reverse        bool
+	Dither         bool
+	AlignWithLayer bool
+	// Offset of gradient center, percent of layer size
+	OffsetX, OffsetY float64
+}
+
+// Gradient stores color and transparency stops. Locations and midpoints are in range [0, 1].
+type Gradient struct {
+	Name       string
+	Noise      bool    // "Noise" gradient, stops aren't available
+	Smoothness float64 // Percent
+	Colors     []*GradientColorStop
+	Opacities  []*GradientOpacityStop
+}
+
+type GradientColorStop struct {
+	Location, Midpoint float64
+	Color              color.NRGBA
+	Type               string // "UsrS" (user color), "FrgC" (foreground) or "BckC" (background)
+}
+
+type GradientOpacityStop struct {
+	Location, Midpoint float64
+	Opacity            float64 // Percent
+}
+
+// PatternFill stores reference to pattern (see "Patt" global block) and its placement.
+type PatternFill struct {
+	Name, ID       string
+	Scale          float64 // Percent
+	AlignWithLayer bool
+	PhaseX, PhaseY float64
+}
+
+// Contour is transfer curve, points are in range [0, 255].
+type Contour struct {
+	Name   string
+	Points []*ContourPoint
+}
+
+type ContourPoint struct {
+	X, Y   float64
+	Corner bool
+}
+
+var (
+	glowTechniques     = map[string]string{"SfBL": "Softer", "PrBL": "Precise"}
+	glowSources        = map[string]string{"SrcC": "Center", "SrcE": "Edge"}
+	bevelStyles        = map[string]string{"OtrB": "Outer bevel", "InrB": "Inner bevel", "Embs": "Emboss", "PlEb": "Pillow emboss", "strokeEmboss": "Stroke emboss"}
+	bevelTechniques    = map[string]string{"SfBL": "Smooth", "PrBL": "Chisel hard", "Slmt": "Chisel soft"}
+	strokePositions    = map[string]string{"OutF": "Outside", "InsF": "Inside", "CtrF": "Center"}
+	strokeFillTypes    = map[string]string{"SClr": "Color", "GrFl": "Gradient", "Ptrn": "Pattern"}
+	gradientStyles     = map[string]string{"Lnr ": "Linear", "Rdl ": "Radial", "Angl": "Angle", "Rflc": "Reflected", "Dmnd": "Diamond"}
+	singleEffectKeys   = []string{"DrSh", "IrSh", "SoFi", "GrFl", "FrFX"}
+	multipleEffectKeys = []string{"dropShadowMulti", "innerShadowMulti", "solidFillMulti", "gradientFillMulti", "frameFXMulti"}
+)
+
+func enumName(names map[string]string, value string) string {
+	if name, ok := names[value]; ok {
+		return name
+	}
+	return value
+}
+
+func blendModeName(value string) string {
+	return enumName(util.DescriptorBlendModes, value)
+}
+
+// ReadLayerEffects reads "lfx2" or "lmfx" block.
+// Global angle and altitude (image resources 1037 and 1049) are used by effects with "Use global light" set.
+func ReadLayerEffects(reader *util.Reader, globalAngle, globalAltitude float64) *LayerEffects {
+	reader.Skip(4) // Object based effects version (= 0)
+	reader.Skip(4) // Descriptor version (= 16)
+	return NewLayerEffects(NewDescriptor(reader), globalAngle, globalAltitude)
+}
+
+// NewLayerEffects maps effects descriptor to typed effects.
+func NewLayerEffects(d *Descriptor, globalAngle, globalAltitude float64) *LayerEffects {
+	effects := new(LayerEffects)
+	effects.Descriptor = d
+	effects.Enabled = d.getBool("masterFXSwitch", true)
+	effects.Scale = d.getFloat("Scl ", 100)
+
+	for i, key := range singleEffectKeys {
+		var list []*Descriptor
+		if d.has(multipleEffectKeys[i]) {
+			for _, entity := range d.getList(multipleEffectKeys[i]) {
+				if value, ok := entity.Value.(*Descriptor); ok {
+					list = append(list, value)
+				}
+			}
+		} else if value := d.getDescriptor(key); value != nil {
+			list = append(list, value)
+		}
+
+		for _, value := range list {
+			switch key {
+			case "DrSh":
+				shadow := &DropShadow{Shadow: readShadow(value, globalAngle)}
+				shadow.LayerKnocksOut = value.getBool("layerConceals", true)
+				effects.DropShadows = append(effects.DropShadows, shadow)
+			case "IrSh":
+				effects.InnerShadows = append(effects.InnerShadows, &InnerShadow{readShadow(value, globalAngle)})
+			case "SoFi":
+				effects.ColorOverlays = append(effects.ColorOverlays, readColorOverlay(value))
+			case "GrFl":
+				effects.GradientOverlays = append(effects.GradientOverlays, readGradientOverlay(value))
+			case "FrFX":
+				effects.Strokes = append(effects.Strokes, readStroke(value))
+			}
+		}
+	}
+
+	if value := d.getDescriptor("OrGl"); value != nil {
+		effects.OuterGlow = &OuterGlow{readGlow(value)}
+	}
+	if value := d.getDescriptor("IrGl"); value != nil {
+		glow := &InnerGlow{Glow: readGlow(value)}
+		glow.Source = enumName(glowSources, value.getEnum("glwS"))
+		effects.InnerGlow = glow
+	}
+	if value := d.getDescriptor("ebbl"); value != nil {
+		effects.BevelEmboss = readBevelEmboss(value, globalAngle, globalAltitude)
+	}
+	if value := d.getDescriptor("ChFX"); value != nil {
+		effects.Satin = readSatin(value)
+	}
+	if value := d.getDescriptor("patternFill"); value != nil {
+		effects.PatternOverlay = &PatternOverlay{readEffect(value), blendModeName(value.getEnum("Md  ")), value.getFloat("Opct", 100), *readPatternFill(value)}
+	}
+
+	return effects
+}
+
+func readEffect(d *Descriptor) Effect {
+	return Effect{d.getBool("enab", false), d.getBool("present", true), d.getBool("showInDialog", true)}
+}
+
+func readShadow(d *Descriptor, globalAngle float64) Shadow {
+	shadow := Shadow{Effect: readEffect(d)}
+	shadow.BlendMode = blendModeName(d.getEnum("Md  "))
+	shadow.Color = readDescriptorColor(d.getDescriptor("Clr "))
+	shadow.Opacity = d.getFloat("Opct", 100)
+	shadow.UseGlobalLight = d.getBool("uglg", true)
+	shadow.LocalAngle = d.getFloat("lagl", 120)
+	shadow.Angle = shadow.LocalAngle
+	if shadow.UseGlobalLight {
+		shadow.Angle = globalAngle
+	}
+	shadow.Distance = d.getFloat("Dstn", 0)
+	shadow.Spread = d.getFloat("Ckmt", 0)
+	shadow.Size = d.getFloat("blur", 0)
+	shadow.Noise = d.getFloat("Nose", 0)
+	shadow.AntiAlias = d.getBool("AntA", false)
+	shadow.Contour = readContour(d.getDescriptor("TrnS"))
+	return shadow
+}
+
+func readGlow(d *Descriptor) Glow {
+	glow := Glow{Effect: readEffect(d)}
+	glow.BlendMode = blendModeName(d.getEnum("Md  "))
+	glow.Color = readDescriptorColor(d.getDescriptor("Clr "))
+	glow.Gradient = readGradient(d.getDescriptor("Grad"))
+	glow.Opacity = d.getFloat("Opct", 100)
+	glow.Technique = enumName(glowTechniques, d.getEnum("GlwT"))
+	glow.Spread = d.getFloat("Ckmt", 0)
+	glow.Size = d.getFloat("blur", 0)
+	glow.Noise = d.getFloat("Nose", 0)
+	glow.Jitter = d.getFloat("ShdN", 0)
+	glow.Range = d.getFloat("Inpr", 50)
+	glow.AntiAlias = d.getBool("AntA", false)
+	glow.Contour = readContour(d.getDescriptor("TrnS"))
+	return glow
+}
+
+func readBevelEmboss(d *Descriptor, globalAngle, globalAltitude float64) *BevelEmboss {
+	bevel := &BevelEmboss{Effect: readEffect(d)}
+	bevel.Style = enumName(bevelStyles, d.getEnum("bvlS"))
+	bevel.Technique = enumName(bevelTechniques, d.getEnum("bvlT"))
+	bevel.Up = d.getEnum("bvlD") != "Out "
+	bevel.Depth = d.getFloat("srgR", 100)
+	bevel.Size = d.getFloat("blur", 0)
+	bevel.Soften = d.getFloat("Sftn", 0)
+	bevel.UseGlobalLight = d.getBool("uglg", true)
+	bevel.LocalAngle = d.getFloat("lagl", 120)
+	bevel.LocalAltitude = d.getFloat("Lald", 30)
+	bevel.Angle, bevel.Altitude = bevel.LocalAngle, bevel.LocalAltitude
+	if bevel.UseGlobalLight {
+		bevel.Angle, bevel.Altitude = globalAngle, globalAltitude
+	}
+	bevel.GlossContour = readContour(d.getDescriptor("TrnS"))
+	bevel.AntiAliasGloss = d.getBool("antialiasGloss", false)
+	bevel.HighlightBlendMode = blendModeName(d.getEnum("hglM"))
+	bevel.HighlightColor = readDescriptorColor(d.getDescriptor("hglC"))
+	bevel.HighlightOpacity = d.getFloat("hglO", 75)
+	bevel.ShadowBlendMode = blendModeName(d.getEnum("sdwM"))
+	bevel.ShadowColor = readDescriptorColor(d.getDescriptor("sdwC"))
+	bevel.ShadowOpacity = d.getFloat("sdwO", 75)
+	bevel.UseShape = d.getBool("useShape", false)
+	bevel.UseTexture = d.getBool("useTexture", false)
+	return bevel
+}
+
+func readSatin(d *Descriptor) *Satin {
+	satin := &Satin{Effect: readEffect(d)}
+	satin.BlendMode = blendModeName(d.getEnum("Md  "))
+	satin.Color = readDescriptorColor(d.getDescriptor("Clr "))
+	satin.Opacity = d.getFloat("Opct", 50)
+	satin.Angle = d.getFloat("lagl", 19)
+	satin.Distance = d.getFloat("Dstn", 0)
+	satin.Size = d.getFloat("blur", 0)
+	satin.Invert = d.getBool("Invr", true)
+	satin.AntiAlias = d.getBool("AntA", false)
+	satin.Contour = readContour(d.getDescriptor("MpgS"))
+	return satin
+}
+
+func readColorOverlay(d *Descriptor) *ColorOverlay {
+	return &ColorOverlay{readEffect(d), blendModeName(d.getEnum("Md  ")), readDescriptorColor(d.getDescriptor("Clr ")), d.getFloat("Opct", 100)}
+}
+
+func readGradientOverlay(d *Descriptor) *GradientOverlay {
+	return &GradientOverlay{readEffect(d), blendModeName(d.getEnum("Md  ")), d.getFloat("Opct", 100), *readGradientFill(d)}
+}
+
+func readStroke(d *Descriptor) *Stroke {
+	stroke := &Stroke{Effect: readEffect(d)}
+	stroke.BlendMode = blendModeName(d.getEnum("Md  "))
+	stroke.Opacity = d.getFloat("Opct", 100)
+	stroke.Position = enumName(strokePositions, d.getEnum("Styl"))
+	stroke.FillType = enumName(strokeFillTypes, d.getEnum("PntT"))
+	stroke.Size = d.getFloat("Sz  ", 0)
+	stroke.Color = readDescriptorColor(d.getDescriptor("Clr "))
+	switch stroke.FillType {
+	case "Gradient":
+		stroke.Gradient = readGradientFill(d)
+	case "Pattern":
+		stroke.Pattern = readPatternFill(d)
+	}
+	return stroke
+}
+
+func readGradientFill(d *Descriptor) *GradientFill {
+	fill := new(GradientFill)
+	fill.Gradient = readGradient(d.getDescriptor("Grad"))
+	fill.Style = enumName(gradientStyles, d.getEnum("Type"))
+	fill.Angle = d.getFloat("Angl", 90)
+	fill.Scale = d.getFloat("Scl ", 100)
+	fill.Reverse = d.getBool("Rvrs", false)
+	fill.Dither = d.getBool("Dthr", false)
+	fill.AlignWithLayer = d.getBool("Algn", true)
+	if offset := d.getDescriptor("Ofst"); offset != nil {
+		fill.OffsetX = offset.getFloat("Hrzn", 0)
+		fill.OffsetY = offset.getFloat("Vrtc", 0)
+	}
+	return fill
+}
+
+func readGradient(d *Descriptor) *Gradient {
+	if d == nil {
+		return nil
+	}
+	gradient := new(Gradient)
+	gradient.Name = d.getString("Nm  ")
+	gradient.Noise = d.getEnum("GrdF") == "ClNs"
+	gradient.Smoothness = d.getFloat("Intr", 4096) / 4096 * 100
+	for _, entity := range d.getList("Clrs") {
+		if stop, ok := entity.Value.(*Descriptor); ok {
+			gradient.Colors = append(gradient.Colors, &GradientColorStop{
+				Location: stop.getFloat("Lctn", 0) / 4096,
+				Midpoint: stop.getFloat("Mdpn", 50) / 100,
+				Color:    readDescriptorColor(stop.getDescriptor("Clr ")),
+				Type:     stop.getEnum("Type"),
+			})
+		}
+	}
+	for _, entity := range d.getList("Trns") {
+		if stop, ok := entity.Value.(*Descriptor); ok {
+			gradient.Opacities = append(gradient.Opacities, &GradientOpacityStop{
+				Location: stop.getFloat("Lctn", 0) / 4096,
+				Midpoint: stop.getFloat("Mdpn", 50) / 100,
+				Opacity:  stop.getFloat("Opct", 100),
+			})
+		}
+	}
+	return gradient
+}
+
+func readPatternFill(d *Descriptor) *PatternFill {
+	fill := new(PatternFill)
+	if pattern := d.getDescriptor("Ptrn"); pattern != nil {
+		fill.Name = pattern.getString("Nm  ")
+		fill.ID = pattern.getString("Idnt")
+	}
+	fill.Scale = d.getFloat("Scl ", 100)
+	fill.AlignWithLayer = d.getBool("Algn", true)
+	if phase := d.getDescriptor("phase"); phase != nil {
+		fill.PhaseX = phase.getFloat("Hrzn", 0)
+		fill.PhaseY = phase.getFloat("Vrtc", 0)
+	}
+	return fill
+}
+
+func readContour(d *Descriptor) *Contour {
+	if d == nil {
+		return nil
+	}
+	contour := new(Contour)
+	contour.Name = d.getString("Nm  ")
+	for _, entity := range d.getList("Crv ") {
+		if point, ok := entity.Value.(*Descriptor); ok {
+			contour.Points = append(contour.Points, &ContourPoint{point.getFloat("Hrzn", 0), point.getFloat("Vrtc", 0), !point.getBool("Cnty", true)})
+		}
+	}
+	return contour
+}
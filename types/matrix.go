@@ -16,3 +16,8 @@ type Matrix struct {
 func ReadMatrix(r *util.Reader) *Matrix {
 	return &Matrix{r.ReadFloat64(), r.ReadFloat64(), r.ReadFloat64(), r.ReadFloat64(), r.ReadFloat64(), r.ReadFloat64()}
 }
+
+// Apply transforms point.
+func (m *Matrix) Apply(x, y float64) (float64, float64) {
+	return m.XX*x + m.YX*y + m.TX, m.XY*x + m.YY*y + m.TY
+}
@@ -1,6 +1,12 @@
 package types
 
-import "github.com/solovev/gopsd/util"
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/solovev/gopsd/util"
+)
 
 type Point struct {
 	RelativeX, RelativeY float32
@@ -8,78 +14,156 @@ type Point struct {
 }
 
 type Knot struct {
-	Controls []*Point
+	Controls []*Point // Control points before and after anchor
 	Anchor   *Point
+	Linked   bool // Controls are moved together
+}
+
+// Subpath is a closed or open figure, combined with the result of previous subpaths by its operation.
+type Subpath struct {
+	Closed    bool
+	Operation string // "Combine", "Subtract", "Intersect" or "Exclude"
+	Knots     []*Knot
 }
 
 type Path struct {
-	IsOpen              bool
+	Width, Height       float32 // Size of document, relative coordinates of points are fractions of it
+	Subpaths            []*Subpath
+	FillRule            string // "Even-odd" if path has fill rule record (Photoshop always writes it), "Nonzero" otherwise
 	StartsWithAllPixels bool
-	Knots               []*Knot
+	Clipboard           *PathClipboard
 }
 
-var (
-	documentWidth, documentHeight float32
-)
+// PathClipboard is bounds and resolution of the clipboard path was copied from, as stored (8.24 fixed point numbers).
+type PathClipboard struct {
+	Top, Left, Bottom, Right float32
+	Resolution               float32
+}
+
+var pathOperations = map[int16]string{0: "Exclude", 1: "Combine", 2: "Subtract", 3: "Intersect"}
 
-// TODO: If windows - reverse byte order?
+// ReadPath reads path resource or vector mask data: 26 byte records of subpath lengths,
+// knots, fill rule, clipboard and initial fill.
 func ReadPath(width, height int32, data []byte) *Path {
 	r := util.NewReader(data)
-	path := new(Path)
-	documentWidth = float32(width)
-	documentHeight = float32(height)
-	index := 0
-	for r.Position < len(data) {
+	path := &Path{Width: float32(width), Height: float32(height), FillRule: "Nonzero"}
+
+	var subpath *Subpath
+	remaining := 0 // Knots of current subpath, which weren't read yet
+	for len(data)-r.Position >= 26 {
 		record := r.ReadInt16()
-		if len(data)-r.Position >= 24 {
-			switch record {
-			case 0, 3:
-				path.IsOpen = record == 3
-				path.Knots = make([]*Knot, r.ReadInt16())
-				r.Skip(22)
-			case 1, 2, 4, 5:
-				if len(path.Knots) == 0 {
-					return nil
-				}
-				path.Knots[index] = readKnot(r)
-				index++
-			case 6: // Path fill
-				r.Skip(24)
-			case 7: // Clipboard
-				r.Skip(24)
-			case 8: // Initial fill
-				path.StartsWithAllPixels = r.ReadInt16() == 1
-				r.Skip(22)
+		start := r.Position
+		switch record {
+		case 0, 3: // Closed and open subpath length
+			subpath = &Subpath{Closed: record == 0, Operation: "Combine"}
+			remaining = int(r.ReadInt16())
+			if operation, ok := pathOperations[r.ReadInt16()]; ok {
+				subpath.Operation = operation
+			}
+			path.Subpaths = append(path.Subpaths, subpath)
+		case 1, 2, 4, 5: // Closed linked, closed unlinked, open linked and open unlinked knots
+			if subpath == nil || remaining == 0 {
+				break
 			}
+			knot := path.readKnot(r)
+			knot.Linked = record == 1 || record == 4
+			subpath.Knots = append(subpath.Knots, knot)
+			remaining--
+		case 6:
+			path.FillRule = "Even-odd"
+		case 7:
+			clipboard := new(PathClipboard)
+			clipboard.Top = readComponent(r)
+			clipboard.Left = readComponent(r)
+			clipboard.Bottom = readComponent(r)
+			clipboard.Right = readComponent(r)
+			clipboard.Resolution = readComponent(r)
+			path.Clipboard = clipboard
+		case 8:
+			path.StartsWithAllPixels = r.ReadInt16() == 1
 		}
+		r.Skip(start + 24 - r.Position)
 	}
 	return path
 }
 
-func readKnot(r *util.Reader) *Knot {
+func (p *Path) readKnot(r *util.Reader) *Knot {
 	knot := new(Knot)
 	knot.Controls = make([]*Point, 2)
 
-	knot.Controls[0] = readPoint(r)
-	knot.Anchor = readPoint(r)
-	knot.Controls[1] = readPoint(r)
+	knot.Controls[0] = p.readPoint(r)
+	knot.Anchor = p.readPoint(r)
+	knot.Controls[1] = p.readPoint(r)
 
 	return knot
 }
 
-func readPoint(r *util.Reader) *Point {
+func (p *Path) readPoint(r *util.Reader) *Point {
 	point := new(Point)
 	point.RelativeY = readComponent(r)
 	point.RelativeX = readComponent(r)
 
-	point.X = point.RelativeX * documentWidth
-	point.Y = point.RelativeY * documentHeight
+	point.X = point.RelativeX * p.Width
+	point.Y = point.RelativeY * p.Height
 
 	return point
 }
 
+// readComponent reads signed 8.24 fixed point number.
 func readComponent(r *util.Reader) float32 {
-	i := float32(r.ReadByte())
-	f := float32(r.ReadInt24()) / 16777216.0
-	return i + f
+	return float32(r.ReadInt32()) / 16777216.0
+}
+
+// SVG returns path data of all subpaths for "d" attribute of SVG path.
+// Operations of subpaths and fill rule aren't a part of path data.
+func (p *Path) SVG() string {
+	data := make([]string, 0, len(p.Subpaths))
+	for _, subpath := range p.Subpaths {
+		if value := subpath.SVG(); value != "" {
+			data = append(data, value)
+		}
+	}
+	return strings.Join(data, " ")
+}
+
+// SVG returns path data of subpath. Segments without control points are written as lines.
+func (s *Subpath) SVG() string {
+	n := len(s.Knots)
+	if n == 0 {
+		return ""
+	}
+	data := []string{"M", svgPoint(s.Knots[0].Anchor)}
+	segments := n - 1
+	if s.Closed {
+		segments = n
+	}
+	for i := 0; i < segments; i++ {
+		from, to := s.Knots[i], s.Knots[(i+1)%n]
+		if from.Controls[1].equals(from.Anchor) && to.Controls[0].equals(to.Anchor) {
+			data = append(data, "L", svgPoint(to.Anchor))
+		} else {
+			data = append(data, "C", svgPoint(from.Controls[1]), svgPoint(to.Controls[0]), svgPoint(to.Anchor))
+		}
+	}
+	if s.Closed {
+		data = append(data, "Z")
+	}
+	return strings.Join(data, " ")
+}
+
+func (p *Point) equals(other *Point) bool {
+	return p.X == other.X && p.Y == other.Y
+}
+
+func svgPoint(p *Point) string {
+	return SVGNumber(float64(p.X)) + " " + SVGNumber(float64(p.Y))
+}
+
+// SVGNumber formats number for SVG, rounded to thousandths.
+func SVGNumber(value float64) string {
+	value = math.Round(value*1000) / 1000
+	if value == 0 {
+		value = 0 // Negative zero
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
 }
@@ -0,0 +1,272 @@
+package types
+
+import "math"
+
+type vec struct {
+	x, y float64
+}
+
+func (a vec) add(b vec) vec            { return vec{a.x + b.x, a.y + b.y} }
+func (a vec) sub(b vec) vec            { return vec{a.x - b.x, a.y - b.y} }
+func (a vec) mul(k float64) vec        { return vec{a.x * k, a.y * k} }
+func (a vec) dot(b vec) float64        { return a.x*b.x + a.y*b.y }
+func (a vec) cross(b vec) float64      { return a.x*b.y - a.y*b.x }
+func (a vec) length() float64          { return math.Hypot(a.x, a.y) }
+func (p *Point) vec(scale float64) vec { return vec{float64(p.X) * scale, float64(p.Y) * scale} }
+
+// Polyline is flattened subpath, coordinates are in pixels of document.
+type Polyline struct {
+	Points []*PointFloat
+	Closed bool
+}
+
+// polyline is flattened subpath. Corners mark points which are knots of subpath, not points within curves.
+type polyline struct {
+	points  []vec
+	corners []bool
+	closed  bool
+}
+
+func (l *polyline) add(point vec, corner bool) {
+	if n := len(l.points); n > 0 && l.points[n-1] == point {
+		l.corners[n-1] = l.corners[n-1] || corner
+		return
+	}
+	l.points = append(l.points, point)
+	l.corners = append(l.corners, corner)
+}
+
+// segments returns cubic Bézier segments of subpath: anchor, its leaving control point,
+// preceding control point of the next knot and its anchor. Closed subpaths have closing segment.
+func (s *Subpath) segments(scale float64) [][4]vec {
+	n := len(s.Knots)
+	count := n - 1
+	if s.Closed {
+		count = n
+	}
+	var segments [][4]vec
+	for i := 0; i < count; i++ {
+		from, to := s.Knots[i], s.Knots[(i+1)%n]
+		segments = append(segments, [4]vec{from.Anchor.vec(scale), from.Controls[1].vec(scale), to.Controls[0].vec(scale), to.Anchor.vec(scale)})
+	}
+	return segments
+}
+
+// flatten converts subpath into polyline with coordinates multiplied by scale.
+// Distance between curves and polyline doesn't exceed tolerance.
+func (s *Subpath) flatten(scale, tolerance float64) *polyline {
+	line := &polyline{closed: s.Closed}
+	if len(s.Knots) == 0 {
+		return line
+	}
+	line.add(s.Knots[0].Anchor.vec(scale), true)
+	for _, segment := range s.segments(scale) {
+		p0, p1, p2, p3 := segment[0], segment[1], segment[2], segment[3]
+		steps := 1
+		if !isStraight(segment, tolerance) {
+			// Number of steps by Wang's formula
+			d := math.Max(p0.sub(p1.mul(2)).add(p2).length(), p1.sub(p2.mul(2)).add(p3).length())
+			steps = int(math.Max(1, math.Min(65536, math.Ceil(math.Sqrt(0.75*d/tolerance)))))
+		}
+		for j := 1; j <= steps; j++ {
+			line.add(cubicAt(p0, p1, p2, p3, float64(j)/float64(steps)), j == steps)
+		}
+	}
+	if last := len(line.points) - 1; s.Closed && last > 0 && line.points[last] == line.points[0] {
+		line.points, line.corners = line.points[:last], line.corners[:last]
+	}
+	return line
+}
+
+// isStraight reports whether control points of segment lie on its chord, so segment is a line.
+func isStraight(segment [4]vec, tolerance float64) bool {
+	chord := segment[3].sub(segment[0])
+	length := chord.length()
+	for _, control := range segment[1:3] {
+		offset := control.sub(segment[0])
+		if length == 0 {
+			if offset.length() > tolerance {
+				return false
+			}
+			continue
+		}
+		along := offset.dot(chord) / length
+		if math.Abs(offset.cross(chord))/length > tolerance/4 || along < 0 || along > length {
+			return false
+		}
+	}
+	return true
+}
+
+func cubicAt(p0, p1, p2, p3 vec, t float64) vec {
+	u := 1 - t
+	return p0.mul(u * u * u).add(p1.mul(3 * u * u * t)).add(p2.mul(3 * u * t * t)).add(p3.mul(t * t * t))
+}
+
+// Flatten converts subpaths into polylines, distance between curves and polylines doesn't exceed tolerance (in pixels).
+func (p *Path) Flatten(tolerance float64) []*Polyline {
+	polylines := make([]*Polyline, len(p.Subpaths))
+	for i, subpath := range p.Subpaths {
+		polylines[i] = subpath.Flatten(tolerance)
+	}
+	return polylines
+}
+
+// Flatten converts subpath into polyline, distance between curves and polyline doesn't exceed tolerance (in pixels).
+func (s *Subpath) Flatten(tolerance float64) *Polyline {
+	line := s.flatten(1, math.Max(tolerance, 1e-6))
+	polyline := &Polyline{Points: make([]*PointFloat, len(line.points)), Closed: s.Closed}
+	for i, point := range line.points {
+		polyline.Points[i] = &PointFloat{point.x, point.y}
+	}
+	return polyline
+}
+
+// Bounds returns exact bounding box of curves of path, nil if path has no knots.
+func (p *Path) Bounds() *RectangleFloat {
+	var bounds *RectangleFloat
+	for _, subpath := range p.Subpaths {
+		bounds = bounds.union(subpath.Bounds())
+	}
+	return bounds
+}
+
+// Bounds returns exact bounding box of curves of subpath, nil if subpath has no knots.
+func (s *Subpath) Bounds() *RectangleFloat {
+	if len(s.Knots) == 0 {
+		return nil
+	}
+	anchor := s.Knots[0].Anchor.vec(1)
+	bounds := &RectangleFloat{anchor.y, anchor.x, anchor.y, anchor.x}
+	for _, segment := range s.segments(1) {
+		p0, p1, p2, p3 := segment[0], segment[1], segment[2], segment[3]
+		bounds.add(p3)
+		// Extrema are at roots of derivative: a*t^2 + b*t + c = 0 for each coordinate
+		a := p3.sub(p0).add(p1.sub(p2).mul(3))
+		b := p0.sub(p1.mul(2)).add(p2).mul(2)
+		c := p1.sub(p0)
+		for _, t := range append(quadraticRoots(a.x, b.x, c.x), quadraticRoots(a.y, b.y, c.y)...) {
+			if t > 0 && t < 1 {
+				bounds.add(cubicAt(p0, p1, p2, p3, t))
+			}
+		}
+	}
+	return bounds
+}
+
+func quadraticRoots(a, b, c float64) []float64 {
+	if math.Abs(a) < 1e-12 {
+		if math.Abs(b) < 1e-12 {
+			return nil
+		}
+		return []float64{-c / b}
+	}
+	d := b*b - 4*a*c
+	if d < 0 {
+		return nil
+	}
+	d = math.Sqrt(d)
+	return []float64{(-b + d) / (2 * a), (-b - d) / (2 * a)}
+}
+
+func (r *RectangleFloat) add(point vec) {
+	r.Left, r.Right = math.Min(r.Left, point.x), math.Max(r.Right, point.x)
+	r.Top, r.Bottom = math.Min(r.Top, point.y), math.Max(r.Bottom, point.y)
+}
+
+func (r *RectangleFloat) union(other *RectangleFloat) *RectangleFloat {
+	switch {
+	case r == nil:
+		return other
+	case other == nil:
+		return r
+	}
+	return &RectangleFloat{math.Min(r.Top, other.Top), math.Min(r.Left, other.Left), math.Max(r.Bottom, other.Bottom), math.Max(r.Right, other.Right)}
+}
+
+// Length returns total length of subpaths in pixels.
+func (p *Path) Length() float64 {
+	length := 0.0
+	for _, subpath := range p.Subpaths {
+		length += subpath.Length()
+	}
+	return length
+}
+
+// Length returns length of subpath in pixels, including closing segment of closed subpath.
+func (s *Subpath) Length() float64 {
+	line := s.flatten(1, 1e-4)
+	length := 0.0
+	for i := 1; i < len(line.points); i++ {
+		length += line.points[i].sub(line.points[i-1]).length()
+	}
+	if s.Closed && len(line.points) > 1 {
+		length += line.points[0].sub(line.points[len(line.points)-1]).length()
+	}
+	return length
+}
+
+// Contains reports whether point of document is inside of path: subpaths are filled by fill rule
+// of path (open ones are closed implicitly) and combined by their operations.
+func (p *Path) Contains(x, y float64) bool {
+	inside := p.StartsWithAllPixels
+	for _, subpath := range p.Subpaths {
+		in := subpath.contains(vec{x, y}, p.FillRule == "Even-odd")
+		switch subpath.Operation {
+		case "Subtract":
+			inside = inside && !in
+		case "Intersect":
+			inside = inside && in
+		case "Exclude":
+			inside = inside != in
+		default:
+			inside = inside || in
+		}
+	}
+	return inside
+}
+
+func (s *Subpath) contains(point vec, evenOdd bool) bool {
+	points := s.flatten(1, flatness).points
+	winding := 0
+	for i, a := range points {
+		b := points[(i+1)%len(points)]
+		switch {
+		case a.y <= point.y && b.y > point.y && b.sub(a).cross(point.sub(a)) > 0:
+			winding++
+		case a.y > point.y && b.y <= point.y && b.sub(a).cross(point.sub(a)) < 0:
+			winding--
+		}
+	}
+	if evenOdd {
+		return winding%2 != 0
+	}
+	return winding != 0
+}
+
+// Transform returns copy of path with transformation applied to its points.
+func (p *Path) Transform(m *Matrix) *Path {
+	result := *p
+	result.Subpaths = make([]*Subpath, len(p.Subpaths))
+	for i, subpath := range p.Subpaths {
+		copied := &Subpath{Closed: subpath.Closed, Operation: subpath.Operation, Knots: make([]*Knot, len(subpath.Knots))}
+		for j, knot := range subpath.Knots {
+			copied.Knots[j] = &Knot{
+				Controls: []*Point{p.transformPoint(knot.Controls[0], m), p.transformPoint(knot.Controls[1], m)},
+				Anchor:   p.transformPoint(knot.Anchor, m),
+				Linked:   knot.Linked,
+			}
+		}
+		result.Subpaths[i] = copied
+	}
+	return &result
+}
+
+func (p *Path) transformPoint(point *Point, m *Matrix) *Point {
+	x, y := m.Apply(float64(point.X), float64(point.Y))
+	result := &Point{X: float32(x), Y: float32(y)}
+	if p.Width > 0 && p.Height > 0 {
+		result.RelativeX, result.RelativeY = result.X/p.Width, result.Y/p.Height
+	}
+	return result
+}
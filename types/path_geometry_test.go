@@ -0,0 +1,117 @@
+package types
+
+import (
+	"math"
+	"testing"
+)
+
+// circleSubpath returns closed subpath of circle built of 4 Bézier curves, like ellipse of Photoshop.
+func circleSubpath(cx, cy, r float32) *Subpath {
+	k := r * 0.5522847498
+	knot := func(x, y, dx, dy float32) *Knot {
+		return &Knot{Controls: []*Point{point(x-dx, y-dy), point(x+dx, y+dy)}, Anchor: point(x, y), Linked: true}
+	}
+	return &Subpath{Closed: true, Operation: "Combine", Knots: []*Knot{
+		knot(cx, cy-r, k, 0), knot(cx+r, cy, 0, k), knot(cx, cy+r, -k, 0), knot(cx-r, cy, 0, -k),
+	}}
+}
+
+func TestPathBounds(t *testing.T) {
+	// Curve bulges down to y = 30 between its anchors at y = 0
+	curve := &Subpath{Knots: []*Knot{
+		{Controls: []*Point{point(10, 0), point(10, 40)}, Anchor: point(10, 0)},
+		{Controls: []*Point{point(40, 40), point(40, 0)}, Anchor: point(40, 0)},
+	}}
+	bounds := newTestPath(curve).Bounds()
+	expected := RectangleFloat{Top: 0, Left: 10, Bottom: 30, Right: 40}
+	if math.Abs(bounds.Top-expected.Top) > 1e-9 || math.Abs(bounds.Left-expected.Left) > 1e-9 ||
+		math.Abs(bounds.Bottom-expected.Bottom) > 1e-9 || math.Abs(bounds.Right-expected.Right) > 1e-9 {
+		t.Errorf("Bounds of curve are %+v, expected %+v", *bounds, expected)
+	}
+	if bounds := newTestPath().Bounds(); bounds != nil {
+		t.Errorf("Bounds of empty path are %+v, expected nil", *bounds)
+	}
+}
+
+func TestPathLength(t *testing.T) {
+	if length, expected := newTestPath(circleSubpath(50, 50, 20)).Length(), 2*math.Pi*20; math.Abs(length-expected) > expected*1e-3 {
+		t.Errorf("Length of circle is %v, expected %v", length, expected)
+	}
+	open := &Subpath{Knots: []*Knot{corner(10, 10), corner(40, 10), corner(40, 50)}}
+	if length := newTestPath(open).Length(); math.Abs(length-70) > 1e-6 {
+		t.Errorf("Length of open subpath is %v, expected 70", length)
+	}
+	open.Closed = true
+	if length := newTestPath(open).Length(); math.Abs(length-120) > 1e-6 {
+		t.Errorf("Length of closed subpath is %v, expected 120", length)
+	}
+}
+
+func TestPathContainsOperations(t *testing.T) {
+	// Points in the first rectangle only, in both, in the second one only and in neither
+	points := [][2]float64{{20, 20}, {40, 40}, {60, 60}, {90, 90}}
+	tests := map[string][4]bool{
+		"Combine":   {true, true, true, false},
+		"Subtract":  {true, false, false, false},
+		"Intersect": {false, true, false, false},
+		"Exclude":   {true, false, true, false},
+	}
+	for operation, expected := range tests {
+		path := newTestPath(rectangle(10, 10, 50, 50, "Combine"), rectangle(30, 30, 70, 70, operation))
+		for i, p := range points {
+			if inside := path.Contains(p[0], p[1]); inside != expected[i] {
+				t.Errorf("%s: Contains(%v, %v) = %v, expected %v", operation, p[0], p[1], inside, expected[i])
+			}
+		}
+	}
+
+	path := newTestPath(rectangle(10, 10, 50, 50, "Subtract"))
+	path.StartsWithAllPixels = true
+	if path.Contains(20, 20) || !path.Contains(90, 90) {
+		t.Errorf("Subtracting from all pixels: Contains(20, 20) = %v, Contains(90, 90) = %v", path.Contains(20, 20), path.Contains(90, 90))
+	}
+}
+
+func TestPathContainsFillRules(t *testing.T) {
+	// Five-pointed star, its center has winding number 2
+	star := &Subpath{Closed: true, Operation: "Combine"}
+	for i := 0; i < 5; i++ {
+		angle := -math.Pi/2 + float64(i)*4*math.Pi/5
+		star.Knots = append(star.Knots, corner(float32(50+40*math.Cos(angle)), float32(50+40*math.Sin(angle))))
+	}
+	path := newTestPath(star)
+	for _, test := range []struct {
+		rule        string
+		center, tip bool
+		outside     bool
+	}{{"Nonzero", true, true, false}, {"Even-odd", false, true, false}} {
+		path.FillRule = test.rule
+		if center, tip, outside := path.Contains(50, 50), path.Contains(50, 15), path.Contains(5, 5); center != test.center || tip != test.tip || outside != test.outside {
+			t.Errorf("%s: center %v, tip %v, outside %v", test.rule, center, tip, outside)
+		}
+	}
+}
+
+func TestPathTransform(t *testing.T) {
+	path := newTestPath(circleSubpath(50, 50, 20))
+	transformed := path.Transform(&Matrix{XX: 2, YY: 0.5, TX: -40, TY: 10})
+
+	knot := transformed.Subpaths[0].Knots[1]
+	if knot.Anchor.X != 100 || knot.Anchor.Y != 35 || knot.Anchor.RelativeX != 1 || knot.Anchor.RelativeY != 0.35 {
+		t.Errorf("Transformed anchor is %+v", *knot.Anchor)
+	}
+	if control := knot.Controls[1]; control.X != 100 || math.Abs(float64(control.Y)-(35+20*0.5522847498/2)) > 1e-4 {
+		t.Errorf("Transformed control point is %+v", *control)
+	}
+	if !knot.Linked || !transformed.Subpaths[0].Closed || transformed.Subpaths[0].Operation != "Combine" {
+		t.Errorf("Transform changed knot or subpath flags")
+	}
+	if anchor := path.Subpaths[0].Knots[1].Anchor; anchor.X != 70 || anchor.Y != 50 {
+		t.Errorf("Transform changed original path: anchor is %+v", *anchor)
+	}
+
+	bounds := transformed.Bounds()
+	if math.Abs(bounds.Left-20) > 1e-4 || math.Abs(bounds.Right-100) > 1e-4 || math.Abs(bounds.Top-25) > 1e-4 || math.Abs(bounds.Bottom-45) > 1e-4 {
+		t.Errorf("Bounds of transformed circle are %+v", *bounds)
+	}
+}
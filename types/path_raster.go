@@ -0,0 +1,445 @@
+package types
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+const (
+	flatness   = 0.01 // Max distance between curve and its flattened polyline in pixels
+	subsamples = 16   // Sampled scanlines per row of pixels
+)
+
+// Extent returns rectangle of pixels covered by path with coordinates multiplied by scale.
+func (p *Path) Extent(scale float64) image.Rectangle {
+	var polygons [][]vec
+	for _, subpath := range p.Subpaths {
+		polygons = append(polygons, subpath.flatten(scale, flatness).points)
+	}
+	return polygonsExtent(polygons)
+}
+
+// StrokeExtent returns rectangle of pixels covered by stroke of path with coordinates multiplied by scale.
+func (p *Path) StrokeExtent(scale float64, stroke *ShapeStroke) image.Rectangle {
+	return polygonsExtent(p.strokePolygons(scale, stroke))
+}
+
+func polygonsExtent(polygons [][]vec) image.Rectangle {
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, polygon := range polygons {
+		for _, point := range polygon {
+			minX, minY = math.Min(minX, point.x), math.Min(minY, point.y)
+			maxX, maxY = math.Max(maxX, point.x), math.Max(maxY, point.y)
+		}
+	}
+	if minX > maxX {
+		return image.Rectangle{}
+	}
+	return image.Rect(int(math.Floor(minX)), int(math.Floor(minY)), int(math.Ceil(maxX)), int(math.Ceil(maxY)))
+}
+
+// Rasterize fills path into anti-aliased mask. Bounds are in pixels of document multiplied by scale.
+// Subpaths are filled by fill rule of path (open ones are closed implicitly) and combined by their operations.
+func (p *Path) Rasterize(bounds image.Rectangle, scale float64) *image.Alpha {
+	return p.fill(bounds, scale).alpha()
+}
+
+func (p *Path) fill(bounds image.Rectangle, scale float64) *coverage {
+	result := newCoverage(bounds)
+	if p.StartsWithAllPixels {
+		for i := range result.values {
+			result.values[i] = 1
+		}
+	}
+	evenOdd := p.FillRule == "Even-odd"
+	shape := newCoverage(bounds)
+	for _, subpath := range p.Subpaths {
+		for i := range shape.values {
+			shape.values[i] = 0
+		}
+		shape.fill([][]vec{subpath.flatten(scale, flatness).points}, evenOdd)
+		result.combine(shape, subpath.Operation)
+	}
+	return result
+}
+
+// RasterizeStroke strokes path into anti-aliased mask using width, alignment, caps, joins and dashes of stroke.
+// Bounds are in pixels of document multiplied by scale.
+func (p *Path) RasterizeStroke(bounds image.Rectangle, scale float64, stroke *ShapeStroke) *image.Alpha {
+	return p.stroke(bounds, scale, stroke, false).alpha()
+}
+
+// stroke clips inside and outside strokes by fill of path, or by area outside of it if inverted is set.
+func (p *Path) stroke(bounds image.Rectangle, scale float64, stroke *ShapeStroke, inverted bool) *coverage {
+	result := newCoverage(bounds)
+	result.fill(p.strokePolygons(scale, stroke), false)
+	if stroke.Alignment != "Inside" && stroke.Alignment != "Outside" {
+		return result
+	}
+	fill := p.fill(bounds, scale)
+	if inverted {
+		fill.invert()
+	}
+	if stroke.Alignment == "Inside" {
+		result.combine(fill, "Intersect")
+	} else {
+		result.combine(fill, "Subtract")
+	}
+	return result
+}
+
+// RasterizeFill fills path of shape into anti-aliased mask, inverted if the shape is.
+// Bounds are in pixels of document multiplied by scale.
+func (s *Shape) RasterizeFill(bounds image.Rectangle, scale float64) *image.Alpha {
+	fill := s.Path.fill(bounds, scale)
+	if s.Inverted {
+		fill.invert()
+	}
+	return fill.alpha()
+}
+
+// RasterizeStroke strokes path of shape like Path.RasterizeStroke, inside and outside of inverted shape swap.
+func (s *Shape) RasterizeStroke(bounds image.Rectangle, scale float64, stroke *ShapeStroke) *image.Alpha {
+	return s.Path.stroke(bounds, scale, stroke, s.Inverted).alpha()
+}
+
+// strokePolygons returns positively oriented polygons, union of which is stroke of path.
+// Inside and outside strokes are centered with double width, they are clipped by fill later.
+func (p *Path) strokePolygons(scale float64, stroke *ShapeStroke) [][]vec {
+	width := stroke.Width * scale
+	halfWidth := width / 2
+	if stroke.Alignment == "Inside" || stroke.Alignment == "Outside" {
+		halfWidth = width
+	}
+	dashes := make([]float64, len(stroke.Dashes))
+	for i, dash := range stroke.Dashes {
+		dashes[i] = math.Max(dash, 0) * width
+	}
+
+	var polygons [][]vec
+	for _, subpath := range p.Subpaths {
+		for _, line := range subpath.flatten(scale, flatness).dashes(dashes, stroke.DashOffset*width) {
+			polygons = append(polygons, line.outline(halfWidth, stroke)...)
+		}
+	}
+	for _, polygon := range polygons {
+		if polygonArea(polygon) < 0 {
+			for i, j := 0, len(polygon)-1; i < j; i, j = i+1, j-1 {
+				polygon[i], polygon[j] = polygon[j], polygon[i]
+			}
+		}
+	}
+	return polygons
+}
+
+// dashes splits polyline into dashes by lengths of dashes and gaps, starting at offset within pattern.
+func (l *polyline) dashes(pattern []float64, offset float64) []*polyline {
+	total := 0.0
+	for _, length := range pattern {
+		total += length
+	}
+	if total <= 0 || len(l.points) == 0 {
+		return []*polyline{l}
+	}
+	points, corners := l.points, l.corners
+	if l.closed {
+		points = append(points[:len(points):len(points)], points[0])
+		corners = append(corners[:len(corners):len(corners)], corners[0])
+	}
+
+	index, left := 0, pattern[0] // Current dash or gap and its remaining length
+	for phase := math.Mod(math.Mod(offset, total)+total, total); phase > 0; {
+		if phase < left {
+			left -= phase
+			break
+		}
+		phase -= left
+		index = (index + 1) % len(pattern)
+		left = pattern[index]
+	}
+
+	var result []*polyline
+	var current *polyline
+	start := func(point vec) {
+		current = &polyline{}
+		current.add(point, true)
+	}
+	if index%2 == 0 {
+		start(points[0])
+	}
+	for i := 1; i < len(points); i++ {
+		a, b := points[i-1], points[i]
+		length, position := b.sub(a).length(), 0.0
+		for length-position > left {
+			position += left
+			point := a.add(b.sub(a).mul(position / length))
+			if current != nil {
+				current.add(point, true)
+				result = append(result, current)
+				current = nil
+			} else {
+				start(point)
+			}
+			index = (index + 1) % len(pattern)
+			left = pattern[index]
+		}
+		left -= length - position
+		if current != nil {
+			current.add(b, corners[i])
+		}
+	}
+	if current != nil {
+		result = append(result, current)
+	}
+	return result
+}
+
+// outline returns polygons covering stroke of polyline: quads of segments, joins and caps.
+func (l *polyline) outline(halfWidth float64, stroke *ShapeStroke) [][]vec {
+	points := l.points
+	n := len(points)
+	if n == 0 || halfWidth <= 0 {
+		return nil
+	}
+	if n == 1 {
+		if !l.closed && stroke.Cap == "Round" {
+			return [][]vec{circle(points[0], halfWidth)}
+		}
+		return nil
+	}
+
+	var polygons [][]vec
+	segments := n - 1
+	if l.closed {
+		segments = n
+	}
+	for i := 0; i < segments; i++ {
+		a, b := points[i], points[(i+1)%n]
+		offset := normal(a, b, halfWidth)
+		polygons = append(polygons, []vec{a.add(offset), b.add(offset), b.sub(offset), a.sub(offset)})
+	}
+	for i := 0; i < n; i++ {
+		if !l.closed && (i == 0 || i == n-1) {
+			continue
+		}
+		join := stroke.Join
+		if !l.corners[i] {
+			join = "Miter" // Points within curves are joined seamlessly
+		}
+		polygons = append(polygons, joinPolygons(points[(i+n-1)%n], points[i], points[(i+1)%n], halfWidth, join, stroke.MiterLimit)...)
+	}
+	if !l.closed {
+		polygons = append(polygons, capPolygons(points[1], points[0], halfWidth, stroke.Cap)...)
+		polygons = append(polygons, capPolygons(points[n-2], points[n-1], halfWidth, stroke.Cap)...)
+	}
+	return polygons
+}
+
+// normal returns perpendicular to segment of specified length.
+func normal(a, b vec, length float64) vec {
+	d := b.sub(a)
+	return vec{-d.y, d.x}.mul(length / d.length())
+}
+
+// joinPolygons returns polygons filling outer side of turn at point. Miter limit is ratio of miter length to stroke width.
+func joinPolygons(prev, point, next vec, halfWidth float64, join string, miterLimit float64) [][]vec {
+	turn := point.sub(prev).cross(next.sub(point))
+	if turn == 0 && point.sub(prev).dot(next.sub(point)) > 0 {
+		return nil
+	}
+	side := 1.0
+	if turn > 0 {
+		side = -1
+	}
+	n1, n2 := normal(prev, point, side), normal(point, next, side)
+	outer1, outer2 := point.add(n1.mul(halfWidth)), point.add(n2.mul(halfWidth))
+	switch join {
+	case "Round":
+		return [][]vec{circle(point, halfWidth)}
+	case "Miter":
+		if cos := n1.dot(n2); cos > -0.999999 && math.Sqrt(2/(1+cos)) <= miterLimit {
+			miter := point.add(n1.add(n2).mul(halfWidth / (1 + cos)))
+			return [][]vec{{point, outer1, miter, outer2}}
+		}
+	}
+	return [][]vec{{point, outer1, outer2}}
+}
+
+// capPolygons returns polygons of cap at the end of segment.
+func capPolygons(from, end vec, halfWidth float64, cap string) [][]vec {
+	switch cap {
+	case "Round":
+		return [][]vec{circle(end, halfWidth)}
+	case "Square":
+		offset := normal(from, end, halfWidth)
+		ahead := vec{offset.y, -offset.x}
+		return [][]vec{{end.add(offset), end.add(offset).add(ahead), end.sub(offset).add(ahead), end.sub(offset)}}
+	}
+	return nil
+}
+
+func circle(center vec, radius float64) []vec {
+	steps := 8
+	if radius > flatness {
+		steps = int(math.Max(8, math.Min(256, math.Ceil(math.Pi/math.Acos(1-flatness/radius)))))
+	}
+	polygon := make([]vec, steps)
+	for i := range polygon {
+		angle := 2 * math.Pi * float64(i) / float64(steps)
+		polygon[i] = center.add(vec{math.Cos(angle), math.Sin(angle)}.mul(radius))
+	}
+	return polygon
+}
+
+func polygonArea(polygon []vec) float64 {
+	area := 0.0
+	for i, a := range polygon {
+		area += a.cross(polygon[(i+1)%len(polygon)])
+	}
+	return area / 2
+}
+
+// coverage stores anti-aliased coverage of pixels within rect in range [0, 1].
+type coverage struct {
+	rect   image.Rectangle
+	values []float32
+}
+
+type edge struct {
+	x0, y0, x1, y1 float64 // y0 < y1
+	direction      int
+}
+
+type crossing struct {
+	x         float64
+	direction int
+}
+
+func newCoverage(rect image.Rectangle) *coverage {
+	return &coverage{rect, make([]float32, rect.Dx()*rect.Dy())}
+}
+
+// fill adds coverage of polygons, which are closed implicitly. Each row of pixels is sampled
+// by several scanlines, horizontal coverage of spans is exact.
+func (c *coverage) fill(polygons [][]vec, evenOdd bool) {
+	var edges []edge
+	for _, polygon := range polygons {
+		for i, a := range polygon {
+			b := polygon[(i+1)%len(polygon)]
+			switch {
+			case a.y < b.y:
+				edges = append(edges, edge{a.x, a.y, b.x, b.y, 1})
+			case a.y > b.y:
+				edges = append(edges, edge{b.x, b.y, a.x, a.y, -1})
+			}
+		}
+	}
+	if len(edges) == 0 || c.rect.Empty() {
+		return
+	}
+	sort.Slice(edges, func(i, j int) bool { return edges[i].y0 < edges[j].y0 })
+
+	width := c.rect.Dx()
+	cells := make([]float32, width+1) // Coverage of pixels by ends of spans
+	runs := make([]float32, width+1)  // Differences of coverage by inner parts of spans
+	const weight = 1.0 / subsamples
+	span := func(x0, x1 float64) {
+		x0 = math.Max(0, math.Min(float64(width), x0-float64(c.rect.Min.X)))
+		x1 = math.Max(0, math.Min(float64(width), x1-float64(c.rect.Min.X)))
+		if x1 <= x0 {
+			return
+		}
+		i0, i1 := int(x0), int(x1)
+		if i0 == i1 {
+			cells[i0] += float32((x1 - x0) * weight)
+			return
+		}
+		cells[i0] += float32((float64(i0+1) - x0) * weight)
+		runs[i0+1] += weight
+		runs[i1] -= weight
+		cells[i1] += float32((x1 - float64(i1)) * weight)
+	}
+
+	var active []*edge
+	var crossings []crossing
+	next := 0
+	for y := c.rect.Min.Y; y < c.rect.Max.Y; y++ {
+		for next < len(edges) && edges[next].y0 < float64(y+1) {
+			active = append(active, &edges[next])
+			next++
+		}
+		kept := active[:0]
+		for _, e := range active {
+			if e.y1 > float64(y) {
+				kept = append(kept, e)
+			}
+		}
+		active = kept
+		if len(active) == 0 {
+			if next == len(edges) {
+				break
+			}
+			continue
+		}
+
+		for s := 0; s < subsamples; s++ {
+			sy := float64(y) + (float64(s)+0.5)/subsamples
+			crossings = crossings[:0]
+			for _, e := range active {
+				if e.y0 <= sy && sy < e.y1 {
+					crossings = append(crossings, crossing{e.x0 + (sy-e.y0)*(e.x1-e.x0)/(e.y1-e.y0), e.direction})
+				}
+			}
+			sort.Slice(crossings, func(i, j int) bool { return crossings[i].x < crossings[j].x })
+			winding := 0
+			for i := 0; i+1 < len(crossings); i++ {
+				winding += crossings[i].direction
+				if (evenOdd && winding%2 != 0) || (!evenOdd && winding != 0) {
+					span(crossings[i].x, crossings[i+1].x)
+				}
+			}
+		}
+
+		row := c.values[(y-c.rect.Min.Y)*width:]
+		var run float32
+		for x := 0; x < width; x++ {
+			run += runs[x]
+			row[x] = float32(math.Min(1, float64(row[x]+run+cells[x])))
+			cells[x], runs[x] = 0, 0
+		}
+		cells[width], runs[width] = 0, 0
+	}
+}
+
+// combine applies operation of subpath to coverage: "Combine", "Subtract", "Intersect" or "Exclude".
+func (c *coverage) combine(shape *coverage, operation string) {
+	for i, b := range shape.values {
+		a := c.values[i]
+		switch operation {
+		case "Subtract":
+			a *= 1 - b
+		case "Intersect":
+			a *= b
+		case "Exclude":
+			a += b - 2*a*b
+		default:
+			a += b - a*b
+		}
+		c.values[i] = a
+	}
+}
+
+func (c *coverage) invert() {
+	for i, value := range c.values {
+		c.values[i] = 1 - value
+	}
+}
+
+func (c *coverage) alpha() *image.Alpha {
+	img := image.NewAlpha(c.rect)
+	for i, value := range c.values {
+		img.Pix[i] = byte(math.Max(0, math.Min(1, float64(value)))*255 + 0.5)
+	}
+	return img
+}
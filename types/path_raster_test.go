@@ -0,0 +1,53 @@
+package types
+
+import (
+	"image"
+	"testing"
+)
+
+// point returns point of path of document with size 100 x 100.
+func point(x, y float32) *Point {
+	return &Point{RelativeX: x / 100, RelativeY: y / 100, X: x, Y: y}
+}
+
+// corner returns knot without curves at x, y.
+func corner(x, y float32) *Knot {
+	return &Knot{Controls: []*Point{point(x, y), point(x, y)}, Anchor: point(x, y)}
+}
+
+// rectangle returns closed subpath of rectangle.
+func rectangle(left, top, right, bottom float32, operation string) *Subpath {
+	return &Subpath{Closed: true, Operation: operation, Knots: []*Knot{
+		corner(left, top), corner(right, top), corner(right, bottom), corner(left, bottom),
+	}}
+}
+
+func newTestPath(subpaths ...*Subpath) *Path {
+	return &Path{Width: 100, Height: 100, FillRule: "Nonzero", Subpaths: subpaths}
+}
+
+func TestShapeRasterizeInverted(t *testing.T) {
+	bounds := image.Rect(0, 0, 20, 20)
+	shape := &Shape{Path: newTestPath(rectangle(5, 5, 15, 15, "Combine"))}
+	if a := shape.RasterizeFill(bounds, 1); a.AlphaAt(10, 10).A != 255 || a.AlphaAt(2, 2).A != 0 {
+		t.Errorf("Fill of shape: inside %d, outside %d", a.AlphaAt(10, 10).A, a.AlphaAt(2, 2).A)
+	}
+	shape.Inverted = true
+	if a := shape.RasterizeFill(bounds, 1); a.AlphaAt(10, 10).A != 0 || a.AlphaAt(2, 2).A != 255 {
+		t.Errorf("Fill of inverted shape: inside %d, outside %d", a.AlphaAt(10, 10).A, a.AlphaAt(2, 2).A)
+	}
+
+	// Inside stroke of inverted shape lies outside of its path
+	stroke := &ShapeStroke{Enabled: true, Width: 2, Alignment: "Inside", Join: "Miter", MiterLimit: 4}
+	for _, inverted := range []bool{false, true} {
+		shape.Inverted = inverted
+		a := shape.RasterizeStroke(bounds, 1, stroke)
+		inside, outside := a.AlphaAt(5, 10).A, a.AlphaAt(4, 10).A
+		if inverted {
+			inside, outside = outside, inside
+		}
+		if inside != 255 || outside != 0 {
+			t.Errorf("Inside stroke of shape (inverted %v): %d at x = 5, %d at x = 4", inverted, a.AlphaAt(5, 10).A, a.AlphaAt(4, 10).A)
+		}
+	}
+}
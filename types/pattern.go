@@ -0,0 +1,119 @@
+package types
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/solovev/gopsd/util"
+)
+
+// Pattern is an image referenced by pattern overlays, strokes and fills (see PatternFill).
+type Pattern struct {
+	ID, Name string
+	Mode     int32 // Image mode (1 = Grayscale, 2 = Indexed, 3 = RGB)
+	Image    image.Image
+}
+
+// ReadPatterns reads "Patt", "Pat2" or "Pat3" block of specified length.
+func ReadPatterns(reader *util.Reader, length int) []*Pattern {
+	var patterns []*Pattern
+	end := reader.Position + length
+	for end-reader.Position > 4 {
+		size := int(reader.ReadInt32())
+		pos := reader.Position
+
+		pattern := new(Pattern)
+		reader.Skip(4) // Version (= 1)
+		pattern.Mode = reader.ReadInt32()
+		height := int(reader.ReadInt16())
+		width := int(reader.ReadInt16())
+		pattern.Name = reader.ReadUnicodeString()
+		pattern.ID = util.DecodeString(reader.ReadPascalString(), nil)
+
+		var palette []color.Color
+		if pattern.Mode == 2 {
+			for i := 0; i < 256; i++ {
+				b := reader.ReadBytes(3)
+				palette = append(palette, color.NRGBA{b[0], b[1], b[2], 255})
+			}
+			reader.Skip(4) // Color count and transparent index
+		}
+		pattern.Image = readPatternData(reader, pattern.Mode, width, height, palette)
+		patterns = append(patterns, pattern)
+
+		size = (size + 3) &^ 0x03
+		reader.Skip(pos + size - reader.Position)
+	}
+	return patterns
+}
+
+// readPatternData reads virtual memory array list of pattern.
+func readPatternData(reader *util.Reader, mode int32, width, height int, palette []color.Color) image.Image {
+	reader.Skip(4) // Version (= 3)
+	length := int(reader.ReadInt32())
+	end := reader.Position + length
+	reader.Skip(16) // Rectangle
+
+	// Channels, user mask and sheet mask
+	count := int(reader.ReadInt32()) + 2
+
+	var channels [][]byte
+	for i := 0; i < count && reader.Position < end; i++ {
+		if reader.ReadInt32() == 0 { // Is written
+			continue
+		}
+		size := int(reader.ReadInt32())
+		if size == 0 {
+			continue
+		}
+		pos := reader.Position
+		depth := reader.ReadInt32()
+		rect := NewRectangle(reader)
+		reader.Skip(2) // Pixel depth
+		compression := reader.ReadByte()
+
+		if depth == 8 && int(rect.Width) == width && int(rect.Height) == height {
+			data := make([]byte, 0, width*height)
+			if compression == 1 {
+				counts := make([]int16, height)
+				for j := range counts {
+					counts[j] = reader.ReadInt16()
+				}
+				for _, n := range counts {
+					for _, b := range util.UnpackRLEBits(reader.ReadSignedBytes(n), width) {
+						data = append(data, byte(b))
+					}
+				}
+			} else {
+				data = reader.ReadBytes(width * height)
+			}
+			channels = append(channels, data)
+		}
+		reader.Skip(pos + size - reader.Position)
+	}
+	reader.Skip(end - reader.Position)
+
+	colors := 3
+	if mode != 3 {
+		colors = 1
+	}
+	if len(channels) < colors {
+		return nil
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for i := 0; i < width*height; i++ {
+		c := color.NRGBA{channels[0][i], channels[0][i], channels[0][i], 255}
+		switch {
+		case mode == 3:
+			c.G, c.B = channels[1][i], channels[2][i]
+		case mode == 2 && palette != nil:
+			c = palette[channels[0][i]].(color.NRGBA)
+		}
+		if len(channels) > colors {
+			c.A = channels[len(channels)-1][i]
+		}
+		img.Pix[4*i], img.Pix[4*i+1], img.Pix[4*i+2], img.Pix[4*i+3] = c.R, c.G, c.B, c.A
+	}
+	return img
+}
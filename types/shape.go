@@ -0,0 +1,221 @@
+package types
+
+import (
+	"image/color"
+
+	"github.com/solovev/gopsd/util"
+)
+
+// Shape is vector content of shape layer: path of its vector mask, live shape origins, fill and stroke.
+type Shape struct {
+	Path        *Path
+	Origins     []*ShapeOrigin
+	Fill        *FillContent
+	FillEnabled bool
+	Stroke      *ShapeStroke // Nil if layer has no stroke data
+	Inverted    bool         // Shape covers area outside of path (vector mask is inverted)
+}
+
+// ShapeOrigin is parametric primitive ("live shape") which produced subpath with Index of shape's path.
+// Coordinates are in pixels of document.
+type ShapeOrigin struct {
+	Type       string // "Rectangle", "Rounded rectangle", "Line", "Ellipse", "Polygon" or "Custom"
+	Index      int
+	Bounds     *RectangleFloat
+	Corners    []*PointFloat // Corners of transformed bounds: top left, top right, bottom right, bottom left
+	Transform  *Matrix       // Transformation applied after the primitive was drawn
+	Resolution float64
+
+	// Radii of corners of rounded rectangle: top left, top right, bottom right, bottom left
+	Radii [4]float64
+
+	// Line
+	LineStart, LineEnd *PointFloat
+	LineWeight         float64
+	ArrowStart         bool
+	ArrowEnd           bool
+	ArrowWidth         float64 // Percent of line weight
+	ArrowLength        float64 // Percent of line weight
+	ArrowConcavity     float64 // Percent
+
+	// Polygon
+	Sides     int
+	Star      bool
+	StarRatio float64 // Percent, depth of star's indents
+
+	Other map[string]interface{} // Values of items which aren't described above
+}
+
+type PointFloat struct {
+	X, Y float64
+}
+
+// FillContent is content of fill layer ("SoCo", "GdFl" and "PtFl" blocks), fill of shape layer ("vscg")
+// or content of shape stroke.
+type FillContent struct {
+	Type     string // "Color", "Gradient" or "Pattern"
+	Color    color.NRGBA
+	Gradient *GradientFill
+	Pattern  *PatternFill
+}
+
+// ShapeStroke is stroke of shape layer ("vstk"). Width is in pixels.
+type ShapeStroke struct {
+	Enabled     bool    `psd:"strokeEnabled"`
+	FillEnabled bool    `psd:"fillEnabled"`
+	Width       float64 `psd:"strokeStyleLineWidth"`
+	Alignment   string  `psd:"strokeStyleLineAlignment"` // "Inside", "Center" or "Outside"
+	Cap         string  `psd:"strokeStyleLineCapType"`   // "Butt", "Round" or "Square"
+	Join        string  `psd:"strokeStyleLineJoinType"`  // "Miter", "Round" or "Bevel"
+	MiterLimit  float64 `psd:"strokeStyleMiterLimit"`
+	// Lengths of dashes and gaps in stroke widths, solid line if empty
+	Dashes       []float64 `psd:"strokeStyleLineDashSet"`
+	DashOffset   float64   `psd:"strokeStyleLineDashOffset"`
+	BlendMode    string    `psd:"strokeStyleBlendMode"`
+	Opacity      float64   `psd:"strokeStyleOpacity"` // Percent
+	ScaleLock    bool      `psd:"strokeStyleScaleLock"`
+	StrokeAdjust bool      `psd:"strokeStyleStrokeAdjust"`
+	Resolution   float64   `psd:"strokeStyleResolution"`
+	Content      *FillContent
+}
+
+var (
+	originTypes      = map[int32]string{1: "Rectangle", 2: "Rounded rectangle", 4: "Line", 5: "Ellipse"}
+	fillTypes        = map[string]string{"SoCo": "Color", "solidColorLayer": "Color", "GdFl": "Gradient", "gradientLayer": "Gradient", "PtFl": "Pattern", "patternLayer": "Pattern"}
+	strokeAlignments = map[string]string{"strokeStyleAlignInside": "Inside", "strokeStyleAlignCenter": "Center", "strokeStyleAlignOutside": "Outside"}
+	strokeCaps       = map[string]string{"strokeStyleButtCap": "Butt", "strokeStyleRoundCap": "Round", "strokeStyleSquareCap": "Square"}
+	strokeJoins      = map[string]string{"strokeStyleMiterJoin": "Miter", "strokeStyleRoundJoin": "Round", "strokeStyleBevelJoin": "Bevel"}
+	originKeys       = []string{"keyOriginType", "keyOriginIndex", "keyOriginShapeBBox", "keyOriginBoxCorners", "Trnf", "keyOriginResolution",
+		"keyOriginRRectRadii", "keyOriginLineStart", "keyOriginLineEnd", "keyOriginLineWeight", "keyOriginLineArrowSt", "keyOriginLineArrowEnd",
+		"keyOriginLineArrWdth", "keyOriginLineArrLngth", "keyOriginLineArrConc", "keyOriginPolySides", "keyOriginPolyTrueStar", "keyOriginPolyStarRatio"}
+)
+
+// ReadShapeOrigins reads "vogk" block.
+func ReadShapeOrigins(reader *util.Reader) (*Descriptor, []*ShapeOrigin) {
+	reader.Skip(4) // Version (= 1 for PS CC)
+	reader.Skip(4) // Descriptor version (= 16)
+	d := NewDescriptor(reader)
+	return d, NewShapeOrigins(d)
+}
+
+// NewShapeOrigins builds origins from descriptor of "vogk" block.
+func NewShapeOrigins(d *Descriptor) []*ShapeOrigin {
+	var origins []*ShapeOrigin
+	for _, entity := range d.getList("keyDescriptorList") {
+		if value, ok := entity.Value.(*Descriptor); ok {
+			origins = append(origins, newShapeOrigin(value))
+		}
+	}
+	return origins
+}
+
+func newShapeOrigin(d *Descriptor) *ShapeOrigin {
+	origin := new(ShapeOrigin)
+	origin.Type = "Custom"
+	if name, ok := originTypes[int32(d.getFloat("keyOriginType", 0))]; ok {
+		origin.Type = name
+	}
+	if d.has("keyOriginPolySides") {
+		origin.Type = "Polygon"
+	}
+	origin.Index = int(d.getFloat("keyOriginIndex", 0))
+	if bounds := d.getDescriptor("keyOriginShapeBBox"); bounds != nil {
+		origin.Bounds = &RectangleFloat{bounds.getFloat("Top ", 0), bounds.getFloat("Left", 0), bounds.getFloat("Btom", 0), bounds.getFloat("Rght", 0)}
+	}
+	if corners := d.getDescriptor("keyOriginBoxCorners"); corners != nil {
+		for _, key := range []string{"rectangleCornerA", "rectangleCornerB", "rectangleCornerC", "rectangleCornerD"} {
+			if point := readPointFloat(corners.getDescriptor(key)); point != nil {
+				origin.Corners = append(origin.Corners, point)
+			}
+		}
+	}
+	if transform := d.getDescriptor("Trnf"); transform != nil {
+		origin.Transform = &Matrix{transform.getFloat("xx", 1), transform.getFloat("xy", 0), transform.getFloat("yx", 0),
+			transform.getFloat("yy", 1), transform.getFloat("tx", 0), transform.getFloat("ty", 0)}
+	}
+	origin.Resolution = d.getFloat("keyOriginResolution", 72)
+	if radii := d.getDescriptor("keyOriginRRectRadii"); radii != nil {
+		origin.Radii = [4]float64{radii.getFloat("topLeft", 0), radii.getFloat("topRight", 0), radii.getFloat("bottomRight", 0), radii.getFloat("bottomLeft", 0)}
+	}
+
+	origin.LineStart = readPointFloat(d.getDescriptor("keyOriginLineStart"))
+	origin.LineEnd = readPointFloat(d.getDescriptor("keyOriginLineEnd"))
+	origin.LineWeight = d.getFloat("keyOriginLineWeight", 0)
+	origin.ArrowStart = d.getBool("keyOriginLineArrowSt", false)
+	origin.ArrowEnd = d.getBool("keyOriginLineArrowEnd", false)
+	origin.ArrowWidth = d.getFloat("keyOriginLineArrWdth", 500)
+	origin.ArrowLength = d.getFloat("keyOriginLineArrLngth", 1000)
+	origin.ArrowConcavity = d.getFloat("keyOriginLineArrConc", 0)
+
+	origin.Sides = int(d.getFloat("keyOriginPolySides", 0))
+	origin.Star = d.getBool("keyOriginPolyTrueStar", false)
+	origin.StarRatio = d.getFloat("keyOriginPolyStarRatio", 100)
+
+	for _, item := range d.Items {
+		if !util.StringValueIs(item.Key, originKeys...) {
+			if origin.Other == nil {
+				origin.Other = make(map[string]interface{})
+			}
+			origin.Other[item.Key] = item.Value
+		}
+	}
+	return origin
+}
+
+func readPointFloat(d *Descriptor) *PointFloat {
+	if d == nil {
+		return nil
+	}
+	return &PointFloat{d.getFloat("Hrzn", 0), d.getFloat("Vrtc", 0)}
+}
+
+// ReadFillContent reads "SoCo", "GdFl" and "PtFl" blocks.
+func ReadFillContent(reader *util.Reader, key string) *FillContent {
+	reader.Skip(4) // Descriptor version (= 16)
+	return NewFillContent(key, NewDescriptor(reader))
+}
+
+// ReadVectorContent reads "vscg" block, fill of shape layer.
+func ReadVectorContent(reader *util.Reader) *FillContent {
+	key := reader.ReadString(4)
+	reader.Skip(4) // Descriptor version (= 16)
+	return NewFillContent(key, NewDescriptor(reader))
+}
+
+// NewFillContent builds fill from descriptor. Type is defined by block key or class of descriptor.
+func NewFillContent(key string, d *Descriptor) *FillContent {
+	fill := &FillContent{Type: enumName(fillTypes, key)}
+	switch fill.Type {
+	case "Color":
+		fill.Color = readDescriptorColor(d.getDescriptor("Clr "))
+	case "Gradient":
+		fill.Gradient = readGradientFill(d)
+	case "Pattern":
+		fill.Pattern = readPatternFill(d)
+	}
+	return fill
+}
+
+// ReadShapeStroke reads "vstk" block.
+func ReadShapeStroke(reader *util.Reader) *ShapeStroke {
+	reader.Skip(4) // Descriptor version (= 16)
+	return NewShapeStroke(NewDescriptor(reader))
+}
+
+func NewShapeStroke(d *Descriptor) *ShapeStroke {
+	stroke := &ShapeStroke{Enabled: true, FillEnabled: true, Width: 1, MiterLimit: 100, Opacity: 100, Resolution: 72}
+	d.unmarshal(stroke)
+	stroke.Alignment = enumName(strokeAlignments, stroke.Alignment)
+	stroke.Cap = enumName(strokeCaps, stroke.Cap)
+	stroke.Join = enumName(strokeJoins, stroke.Join)
+	stroke.BlendMode = blendModeName(stroke.BlendMode)
+	if item := d.item("strokeStyleLineWidth"); item != nil {
+		if width, ok := item.Value.(*DescriptorUnitFloat); ok && width.Type == "#Pnt" {
+			stroke.Width *= stroke.Resolution / 72 // Points to pixels
+		}
+	}
+	if content := d.getDescriptor("strokeStyleContent"); content != nil {
+		stroke.Content = NewFillContent(content.Class, content)
+	}
+	return stroke
+}
@@ -0,0 +1,55 @@
+package types
+
+import "image/color"
+
+// SmartFilters is filter stack of smart object ("filterFX" item of "SoLd"), filters are listed from top to bottom.
+type SmartFilters struct {
+	Enabled             bool `psd:"enab"`
+	ValidAtPosition     bool `psd:"validAtPosition"`
+	MaskEnabled         bool `psd:"filterMaskEnable"`
+	MaskLinked          bool `psd:"filterMaskLinked"`
+	MaskExtendWithWhite bool `psd:"filterMaskExtendWithWhite"`
+	Filters             []*SmartFilter
+}
+
+// SmartFilter is a filter applied to smart object.
+type SmartFilter struct {
+	Name       string      `psd:"Nm  "` // Name shown in Photoshop, e.g. "Gaussian Blur"
+	ID         int         `psd:"filterID"`
+	Enabled    bool        `psd:"enab"`
+	HasOptions bool        `psd:"hasoptions"`
+	Foreground color.NRGBA `psd:"FrgC"` // Colors used by some filters (e.g. "Clouds")
+	Background color.NRGBA `psd:"BckC"`
+	BlendMode  string
+	Opacity    float64 // Percent
+
+	Class      string      // Class of Parameters, e.g. "GsnB"
+	Parameters *Descriptor `psd:"Fltr"` // Settings of filter, e.g. "Rds " (radius) of Gaussian Blur
+}
+
+// NewSmartFilters builds filters from "filterFX" descriptor.
+func NewSmartFilters(d *Descriptor) *SmartFilters {
+	filters := &SmartFilters{Enabled: true}
+	d.unmarshal(filters)
+	for _, entity := range d.getList("filterFXList") {
+		if value, ok := entity.Value.(*Descriptor); ok {
+			filters.Filters = append(filters.Filters, newSmartFilter(value))
+		}
+	}
+	return filters
+}
+
+func newSmartFilter(d *Descriptor) *SmartFilter {
+	filter := &SmartFilter{Enabled: true, BlendMode: "Normal", Opacity: 100}
+	d.unmarshal(filter)
+	if filter.Parameters != nil {
+		filter.Class = filter.Parameters.Class
+	}
+	if options := d.getDescriptor("blendOptions"); options != nil {
+		filter.Opacity = options.getFloat("Opct", 100)
+		if mode := options.getEnum("Md  "); mode != "" {
+			filter.BlendMode = blendModeName(mode)
+		}
+	}
+	return filter
+}
@@ -0,0 +1,121 @@
+package types
+
+import (
+	"fmt"
+
+	"github.com/solovev/gopsd/util"
+)
+
+// SmartObject is placed content of smart object layer ("SoLd", "SoLE" or obsolete "PlLd" block).
+type SmartObject struct {
+	Descriptor *Descriptor // Nil for "PlLd"
+	ID         string      `psd:"Idnt"`   // Unique ID of placed file, which links layer to its data
+	PlacedID   string      `psd:"placed"` // Unique ID of placed instance
+	Type       string      // "Unknown", "Vector", "Raster" or "Image stack"
+	Page       int         `psd:"PgNm"` // Page of multi-page document (e.g. PDF)
+	TotalPages int         `psd:"totalPages"`
+	AntiAlias  int         `psd:"Annt"` // Anti-aliasing policy, 0 = none
+	Width      float64     // Original size of placed content in pixels
+	Height     float64
+	Resolution float64 `psd:"Rslt"` // Pixels per inch of placed content
+
+	// x and y of corners of placed content in document: top left, top right, bottom right, bottom left
+	Transform          [8]float64
+	NonAffineTransform [8]float64 // Same as Transform, but includes perspective distortion
+	Warp               *Warp
+
+	SmartFilters *SmartFilters // Nil if no filters were applied
+
+	Warnings []string `json:",omitempty"` // Problems found while reading, e.g. warp which is rendered unwarped
+}
+
+var placedTypes = map[int32]string{0: "Unknown", 1: "Vector", 2: "Raster", 3: "Image stack"}
+
+// ReadPlacedLayer reads "PlLd" block.
+func ReadPlacedLayer(reader *util.Reader) *SmartObject {
+	so := &SmartObject{Resolution: 72}
+	reader.Skip(4) // Type (= "plcL")
+	reader.Skip(4) // Version (= 3)
+	so.ID = reader.ReadPascalString()
+	so.Page = int(reader.ReadInt32())
+	so.TotalPages = int(reader.ReadInt32())
+	so.AntiAlias = int(reader.ReadInt32())
+	so.Type = placedTypeName(reader.ReadInt32())
+	for i := range so.Transform {
+		so.Transform[i] = reader.ReadFloat64()
+	}
+	so.NonAffineTransform = so.Transform
+	reader.Skip(4) // Warp version (= 0)
+	reader.Skip(4) // Descriptor version (= 16)
+	so.Warp = NewWarp(NewDescriptor(reader))
+	so.checkWarp()
+	return so
+}
+
+// ReadSmartObject reads "SoLd" and "SoLE" blocks.
+func ReadSmartObject(reader *util.Reader) *SmartObject {
+	reader.Skip(4) // Identifier (= "soLD")
+	reader.Skip(4) // Version (= 4 or 5)
+	reader.Skip(4) // Descriptor version (= 16)
+	return NewSmartObject(NewDescriptor(reader))
+}
+
+// NewSmartObject builds smart object from descriptor of "SoLd" block.
+func NewSmartObject(d *Descriptor) *SmartObject {
+	so := &SmartObject{Descriptor: d, Page: 1, TotalPages: 1, Resolution: 72}
+	d.unmarshal(so)
+	so.Type = placedTypeName(int32(d.getFloat("Type", 0)))
+	if size := d.getDescriptor("Sz  "); size != nil {
+		so.Width, so.Height = size.getFloat("Wdth", 0), size.getFloat("Hght", 0)
+	}
+	copy(so.Transform[:], entityFloats(d.item("Trnf")))
+	so.NonAffineTransform = so.Transform
+	copy(so.NonAffineTransform[:], entityFloats(d.item("nonAffineTransform")))
+	if warp := d.getDescriptor("warp"); warp != nil {
+		so.Warp = NewWarp(warp)
+		so.checkWarp()
+	}
+	if filters := d.getDescriptor("filterFX"); filters != nil {
+		so.SmartFilters = NewSmartFilters(filters)
+	}
+	return so
+}
+
+// checkWarp warns about standard warp style without mesh: meshes of standard styles aren't built,
+// so such smart object is rendered unwarped.
+func (so *SmartObject) checkWarp() {
+	warp := so.Warp
+	if warp.Style != "" && warp.Style != "None" && len(warp.Mesh) == 0 {
+		so.Warnings = append(so.Warnings, fmt.Sprintf("Warp \"%s\" has no mesh, smart object is rendered unwarped", warp.Style))
+	}
+}
+
+func placedTypeName(value int32) string {
+	if name, ok := placedTypes[value]; ok {
+		return name
+	}
+	return "Unknown"
+}
+
+// entityFloats returns numbers of list ("VlLs"), list of unit floats ("UnFl") or
+// the first list of object array ("ObAr"). Safe for nil entity.
+func entityFloats(item *DescriptorEntity) []float64 {
+	if item == nil {
+		return nil
+	}
+	switch value := item.Value.(type) {
+	case []*DescriptorEntity:
+		numbers := make([]float64, len(value))
+		for i, entity := range value {
+			numbers[i] = entityFloat(entity, 0)
+		}
+		return numbers
+	case *DescriptorUnitFloats:
+		return value.Values
+	case *DescriptorObjectArray:
+		if len(value.Items) > 0 {
+			return entityFloats(value.Items[0])
+		}
+	}
+	return nil
+}
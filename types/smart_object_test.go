@@ -0,0 +1,18 @@
+package types
+
+import "testing"
+
+func TestSmartObjectWarpWarnings(t *testing.T) {
+	tests := map[string]*Warp{
+		"None":   {Style: "None"},
+		"Custom": {Style: "Custom", Mesh: make([]*PointFloat, 16)},
+		"Arc":    {Style: "Arc"},
+	}
+	for style, warp := range tests {
+		so := &SmartObject{Warp: warp}
+		so.checkWarp()
+		if warned := len(so.Warnings) > 0; warned != (style == "Arc") {
+			t.Errorf("Warp \"%s\": warnings %v", style, so.Warnings)
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package types
+
+import (
+	"image/color"
+	"math"
+	"reflect"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// Text is content of text layer with its character and paragraph styles.
+// Paragraphs of text are separated by "\n", runs cover the text without gaps.
+type Text struct {
+	Text       string
+	Styles     []*CharacterStyle
+	Paragraphs []*ParagraphStyle
+}
+
+// CharacterStyle is a style of text run. Start and Length are in characters (runes) of text.
+// Sizes are in points (pixels of 72 ppi document), with transformation of text layer applied.
+type CharacterStyle struct {
+	Start, Length int
+
+	Font          string // PostScript name
+	FontSize      float64
+	AutoLeading   bool
+	Leading       float64 // Distance between baselines, FontSize * paragraph's AutoLeading if AutoLeading is true
+	Tracking      float64 // Thousandths of em
+	Color         color.NRGBA
+	FauxBold      bool
+	FauxItalic    bool
+	Caps          string // "Normal", "Small caps" or "All caps"
+	Baseline      string // "Normal", "Superscript" or "Subscript"
+	Underline     bool
+	Strikethrough bool
+	BaselineShift float64
+}
+
+// ParagraphStyle is a style of paragraph run. Start and Length are in characters (runes) of text.
+// Indents and spaces are in points, with transformation of text layer applied.
+type ParagraphStyle struct {
+	Start, Length int
+
+	Alignment       string // "Left", "Right", "Center", "Justify left", "Justify right", "Justify center" or "Justify all"
+	FirstLineIndent float64
+	StartIndent     float64
+	EndIndent       float64
+	SpaceBefore     float64
+	SpaceAfter      float64
+	AutoLeading     float64 // Factor of font size used as leading if it is auto
+}
+
+var (
+	textAlignments = []string{"Left", "Right", "Center", "Justify left", "Justify right", "Justify center", "Justify all"}
+	textCaps       = []string{"Normal", "Small caps", "All caps"}
+	textBaselines  = []string{"Normal", "Superscript", "Subscript"}
+)
+
+// Text returns content and styles of text. Nil if text data is not available.
+func (tt *TypeTool) Text() *Text {
+	if tt.TextData == nil {
+		return nil
+	}
+	value := tt.TextData.getString("Txt ")
+	engine := tt.EngineData
+	if engine == nil || engine.EngineDict == nil {
+		return &Text{Text: normalizeText(value)}
+	}
+	editor := engine.EngineDict.Editor.Text
+	if value == "" {
+		value = strings.TrimSuffix(editor, "\r")
+	}
+	text := &Text{Text: normalizeText(value)}
+	scale := tt.Transformation.verticalScale()
+	hscale := tt.Transformation.horizontalScale()
+	length := len([]rune(text.Text))
+	offsets := runeOffsets(editor)
+	dict, _ := engine.raw["EngineDict"].(map[string]interface{})
+
+	forEachRun(dict["ParagraphRun"], "ParagraphSheet", "Properties", offsets, length, func(start, end int, layers []interface{}) {
+		data := new(ParagraphProperties)
+		data.AutoLeading = 1.2
+		decodeEngineValue(engine.normalSheet("ParagraphSheetSet", "TheNormalParagraphSheet", "Properties"), reflect.ValueOf(data).Elem())
+		for _, layer := range layers {
+			decodeEngineValue(layer, reflect.ValueOf(data).Elem())
+		}
+		text.Paragraphs = append(text.Paragraphs, &ParagraphStyle{
+			Start: start, Length: end - start,
+			Alignment:       enumAt(textAlignments, data.Justification),
+			FirstLineIndent: data.FirstLineIndent * hscale,
+			StartIndent:     data.StartIndent * hscale,
+			EndIndent:       data.EndIndent * hscale,
+			SpaceBefore:     data.SpaceBefore * scale,
+			SpaceAfter:      data.SpaceAfter * scale,
+			AutoLeading:     data.AutoLeading,
+		})
+	})
+
+	forEachRun(dict["StyleRun"], "StyleSheet", "StyleSheetData", offsets, length, func(start, end int, layers []interface{}) {
+		data := &StyleSheetData{FontSize: 12, AutoLeading: true, HorizontalScale: 1, VerticalScale: 1}
+		decodeEngineValue(engine.normalSheet("StyleSheetSet", "TheNormalStyleSheet", "StyleSheetData"), reflect.ValueOf(data).Elem())
+		for _, layer := range layers {
+			decodeEngineValue(layer, reflect.ValueOf(data).Elem())
+		}
+		style := &CharacterStyle{
+			Start: start, Length: end - start,
+			FontSize:      data.FontSize * scale,
+			AutoLeading:   data.AutoLeading,
+			Leading:       data.Leading * scale,
+			Tracking:      data.Tracking,
+			Color:         data.FillColor.NRGBA(),
+			FauxBold:      data.FauxBold,
+			FauxItalic:    data.FauxItalic,
+			Caps:          enumAt(textCaps, data.FontCaps),
+			Baseline:      enumAt(textBaselines, data.FontBaseline),
+			Underline:     data.Underline,
+			Strikethrough: data.Strikethrough,
+			BaselineShift: data.BaselineShift * scale,
+		}
+		if resources := engine.ResourceDict; resources != nil && data.Font >= 0 && data.Font < len(resources.FontSet) {
+			style.Font = resources.FontSet[data.Font].Name
+		}
+		if style.AutoLeading {
+			style.Leading = style.FontSize * text.autoLeadingAt(start)
+		}
+		text.Styles = append(text.Styles, style)
+	})
+	return text
+}
+
+// Text returns content and styles of legacy text. Each line entry of type tool covers CharacterCount
+// characters, of which only the first one (ActCharacter) is stored, the rest are U+FFFD.
+func (tt *ObsoleteTypeTool) Text() *Text {
+	lines := tt.Lines
+	for len(lines) > 0 && lines[len(lines)-1].ActCharacter == "\x00" {
+		lines = lines[:len(lines)-1]
+	}
+	var chars []rune
+	breaks := make([]bool, len(lines)) // Entry ends paragraph
+	starts := make([]int, len(lines)+1)
+	for i, line := range lines {
+		starts[i] = len(chars)
+		char := []rune(line.ActCharacter + "\x00")[0]
+		if char == '\r' || char == '\x03' {
+			char, breaks[i] = '\n', true
+		}
+		chars = append(chars, char)
+		for n := line.CharacterCount; n > 1; n-- {
+			chars = append(chars, unicode.ReplacementChar)
+		}
+	}
+	starts[len(lines)] = len(chars)
+	text := &Text{Text: string(chars)}
+	scale := tt.Transformation.verticalScale()
+	textColor := color.NRGBA{0, 0, 0, 255}
+	if tt.Color != nil {
+		textColor = tt.Color.NRGBA(tt.ColorSpace)
+	}
+
+	for start := 0; start < len(lines); {
+		end := start + 1
+		for end < len(lines) && !breaks[end-1] {
+			end++
+		}
+		text.Paragraphs = append(text.Paragraphs, &ParagraphStyle{
+			Start: starts[start], Length: starts[end] - starts[start],
+			Alignment:   enumAt(textAlignments, int(lines[start].Alignment)),
+			AutoLeading: 1.2,
+		})
+		start = end
+	}
+
+	for start := 0; start < len(lines); {
+		end := start + 1
+		for end < len(lines) && lines[end].Style == lines[start].Style {
+			end++
+		}
+		style := &CharacterStyle{
+			Start: starts[start], Length: starts[end] - starts[start],
+			FontSize:    12 * scale,
+			AutoLeading: true,
+			Color:       textColor,
+			Caps:        textCaps[0],
+			Baseline:    textBaselines[0],
+		}
+		if data := tt.style(lines[start].Style); data != nil {
+			style.FontSize = fixed(data.Size) * scale
+			style.Tracking = float64(data.Tracking)
+			style.AutoLeading = data.Leading == 0
+			style.Leading = fixed(data.Leading) * scale
+			style.BaselineShift = fixed(data.BaseShift) * scale
+			if face := tt.face(data.FaceMark); face != nil {
+				style.Font = face.FontName
+			}
+		}
+		if style.AutoLeading {
+			style.Leading = style.FontSize * text.autoLeadingAt(style.Start)
+		}
+		text.Styles = append(text.Styles, style)
+		start = end
+	}
+	return text
+}
+
+// style returns style by its mark, falling back to index.
+func (tt *ObsoleteTypeTool) style(mark int16) *TypeStyle {
+	for _, style := range tt.Styles {
+		if style.Mark == mark {
+			return style
+		}
+	}
+	if mark >= 0 && int(mark) < len(tt.Styles) {
+		return tt.Styles[mark]
+	}
+	return nil
+}
+
+// face returns font face by its mark, falling back to index.
+func (tt *ObsoleteTypeTool) face(mark int16) *TypeFace {
+	for _, face := range tt.Faces {
+		if face.Mark == mark {
+			return face
+		}
+	}
+	if mark >= 0 && int(mark) < len(tt.Faces) {
+		return tt.Faces[mark]
+	}
+	return nil
+}
+
+// Scaled returns copy of text with sizes of styles multiplied by factor, e.g. by resolution / 72.
+func (t *Text) Scaled(factor float64) *Text {
+	scaled := &Text{Text: t.Text}
+	for _, style := range t.Styles {
+		style := *style
+		style.FontSize *= factor
+		style.Leading *= factor
+		style.BaselineShift *= factor
+		scaled.Styles = append(scaled.Styles, &style)
+	}
+	for _, paragraph := range t.Paragraphs {
+		paragraph := *paragraph
+		paragraph.FirstLineIndent *= factor
+		paragraph.StartIndent *= factor
+		paragraph.EndIndent *= factor
+		paragraph.SpaceBefore *= factor
+		paragraph.SpaceAfter *= factor
+		scaled.Paragraphs = append(scaled.Paragraphs, &paragraph)
+	}
+	return scaled
+}
+
+// autoLeadingAt returns auto leading factor of paragraph containing character.
+func (t *Text) autoLeadingAt(index int) float64 {
+	for _, paragraph := range t.Paragraphs {
+		if index >= paragraph.Start && index < paragraph.Start+paragraph.Length {
+			return paragraph.AutoLeading
+		}
+	}
+	return 1.2
+}
+
+// normalSheet returns raw data of the normal style or paragraph sheet of resources.
+func (e *EngineData) normalSheet(set, normal, data string) interface{} {
+	resources, _ := e.raw["ResourceDict"].(map[string]interface{})
+	sheets, _ := resources[set].([]interface{})
+	index, _ := resources[normal].(float64)
+	if int(index) < 0 || int(index) >= len(sheets) {
+		return nil
+	}
+	sheet, _ := sheets[int(index)].(map[string]interface{})
+	return sheet[data]
+}
+
+// forEachRun calls f for each run with its range in runes and raw style data: data of default run and of the run.
+func forEachRun(value interface{}, sheet, data string, offsets []int, length int, f func(start, end int, layers []interface{})) {
+	run, _ := value.(map[string]interface{})
+	runs, _ := run["RunArray"].([]interface{})
+	lengths, _ := run["RunLengthArray"].([]interface{})
+	styleData := func(value interface{}) interface{} {
+		item, _ := value.(map[string]interface{})
+		sheet, _ := item[sheet].(map[string]interface{})
+		return sheet[data]
+	}
+	defaults := styleData(run["DefaultRunData"])
+
+	position := 0
+	for i, item := range runs {
+		if i >= len(lengths) {
+			break
+		}
+		count, _ := lengths[i].(float64)
+		start, end := position, position+int(count)
+		position = end
+
+		startRune, endRune := runeIndex(offsets, start), runeIndex(offsets, end)
+		if startRune >= length {
+			break
+		}
+		if endRune > length || i == len(runs)-1 {
+			endRune = length
+		}
+		f(startRune, endRune, []interface{}{defaults, styleData(item)})
+	}
+}
+
+// runeOffsets returns offsets in UTF-16 code units of string for runes of its normalized text
+// (see normalizeText), where "\r\n" is a single rune.
+func runeOffsets(s string) []int {
+	var offsets []int
+	offset := 0
+	previous := rune(0)
+	for _, r := range s {
+		if r != '\n' || previous != '\r' {
+			offsets = append(offsets, offset)
+		}
+		offset += len(utf16.Encode([]rune{r}))
+		previous = r
+	}
+	return append(offsets, offset)
+}
+
+// runeIndex converts offset in UTF-16 code units to index of rune of normalized text.
+func runeIndex(offsets []int, offset int) int {
+	for i, o := range offsets {
+		if o >= offset {
+			return i
+		}
+	}
+	return len(offsets) - 1
+}
+
+// normalizeText trims terminating zero and converts line breaks ("\r" and "\x03" in Photoshop) to "\n".
+func normalizeText(s string) string {
+	s = strings.TrimRight(s, "\x00")
+	return strings.NewReplacer("\r\n", "\n", "\r", "\n", "\x03", "\n").Replace(s)
+}
+
+func enumAt(names []string, index int) string {
+	if index >= 0 && index < len(names) {
+		return names[index]
+	}
+	return names[0]
+}
+
+// NRGBA converts engine color to RGB color. Nil color is black.
+func (c *EngineColor) NRGBA() color.NRGBA {
+	if c == nil || len(c.Values) < 4 {
+		return color.NRGBA{0, 0, 0, 255}
+	}
+	v := c.Values
+	return color.NRGBA{toByte(v[1]), toByte(v[2]), toByte(v[3]), toByte(v[0])}
+}
+
+// verticalScale returns scale of text sizes by transformation.
+func (m *Matrix) verticalScale() float64 {
+	if m == nil {
+		return 1
+	}
+	return math.Hypot(m.YX, m.YY)
+}
+
+func (m *Matrix) horizontalScale() float64 {
+	if m == nil {
+		return 1
+	}
+	return math.Hypot(m.XX, m.XY)
+}
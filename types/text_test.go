@@ -0,0 +1,45 @@
+package types
+
+import "testing"
+
+func TestObsoleteTypeToolTextRuns(t *testing.T) {
+	tt := &ObsoleteTypeTool{Lines: []*TextLine{
+		{CharacterCount: 3, ActCharacter: "a", Style: 0},
+		{CharacterCount: 1, ActCharacter: "\r", Style: 0},
+		{CharacterCount: 2, ActCharacter: "b", Style: 1, Alignment: 2},
+		{CharacterCount: 1, ActCharacter: "\x00"},
+	}}
+	text := tt.Text()
+	if text.Text != "a��\nb�" {
+		t.Errorf("text %q", text.Text)
+	}
+	var got []int
+	for _, style := range text.Styles {
+		got = append(got, style.Start, style.Length)
+	}
+	if want := []int{0, 4, 4, 2}; !equalInts(got, want) {
+		t.Errorf("style runs %v, want %v", got, want)
+	}
+	got = nil
+	for _, paragraph := range text.Paragraphs {
+		got = append(got, paragraph.Start, paragraph.Length)
+	}
+	if want := []int{0, 4, 4, 2}; !equalInts(got, want) {
+		t.Errorf("paragraph runs %v, want %v", got, want)
+	}
+	if text.Paragraphs[1].Alignment != "Center" {
+		t.Errorf("alignment %s, want Center", text.Paragraphs[1].Alignment)
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -1,28 +1,141 @@
 package types
 
-import "github.com/solovev/gopsd/util"
+import (
+	"github.com/solovev/gopsd/util"
+	"golang.org/x/text/encoding"
+)
 
 type TypeTool struct {
 	Transformation *Matrix
 	TextData       *Descriptor
 	WarpData       *Descriptor
-	// BBox           *RectangleFloat // CHECK TODO Info in spec is not even clear, wtf is 4 * 8? Floats?
+	EngineData     *EngineData // Parsed "EngineData" item of TextData
+	Warp           *Warp
+	Bounds         *RectangleFloat // Bounds of text in text coordinates (see Transformation)
 }
 
-func ReadTypeTool(reader *util.Reader) *TypeTool {
+// Warp stores parameters of text (or placed layer) warp. Value and perspectives are in percent.
+type Warp struct {
+	Style            string  `psd:"warpStyle"` // "None", "Arc", "Arc lower", ... or "Custom"
+	Value            float64 `psd:"warpValue"`
+	Perspective      float64 `psd:"warpPerspective"`
+	PerspectiveOther float64 `psd:"warpPerspectiveOther"`
+	Orientation      string  `psd:"warpRotate"` // "Horizontal" or "Vertical"
+
+	// Custom (envelope) warp of placed layer: mesh of UOrder x VOrder control points of bicubic patches
+	// (4 x 4 for one patch) over Bounds, row by row. Quilt warp has Rows x Columns patches,
+	// SliceX and SliceY are positions of their edges.
+	Bounds         *RectangleFloat
+	UOrder         int `psd:"uOrder"`
+	VOrder         int `psd:"vOrder"`
+	Rows           int `psd:"deformNumRows"`
+	Columns        int `psd:"deformNumCols"`
+	Mesh           []*PointFloat
+	SliceX, SliceY []float64
+}
+
+var (
+	warpStyles = map[string]string{
+		"warpNone": "None", "warpArc": "Arc", "warpArcLower": "Arc lower", "warpArcUpper": "Arc upper",
+		"warpArch": "Arch", "warpBulge": "Bulge", "warpShellLower": "Shell lower", "warpShellUpper": "Shell upper",
+		"warpFlag": "Flag", "warpWave": "Wave", "warpFish": "Fish", "warpRise": "Rise", "warpFisheye": "Fisheye",
+		"warpInflate": "Inflate", "warpSqueeze": "Squeeze", "warpTwist": "Twist", "warpCustom": "Custom",
+	}
+	orientations = map[string]string{"Hrzn": "Horizontal", "Vrtc": "Vertical"}
+)
+
+// NewWarp builds warp from "warp" descriptor.
+func NewWarp(d *Descriptor) *Warp {
+	warp := new(Warp)
+	d.unmarshal(warp)
+	warp.Style = enumName(warpStyles, warp.Style)
+	warp.Orientation = enumName(orientations, warp.Orientation)
+	if bounds := d.getDescriptor("bounds"); bounds != nil {
+		warp.Bounds = &RectangleFloat{bounds.getFloat("Top ", 0), bounds.getFloat("Left", 0), bounds.getFloat("Btom", 0), bounds.getFloat("Rght", 0)}
+	}
+	if envelope := d.getDescriptor("customEnvelopeWarp"); envelope != nil {
+		if item := envelope.item("meshPoints"); item != nil {
+			if mesh, ok := item.Value.(*DescriptorObjectArray); ok {
+				x, y := entityFloats(mesh.item("Hrzn")), entityFloats(mesh.item("Vrtc"))
+				for i := 0; i < len(x) && i < len(y); i++ {
+					warp.Mesh = append(warp.Mesh, &PointFloat{x[i], y[i]})
+				}
+			}
+		}
+		warp.SliceX = entityFloats(envelope.item("quiltSliceX"))
+		warp.SliceY = entityFloats(envelope.item("quiltSliceY"))
+	}
+	return warp
+}
+
+// IsBox reports whether text is paragraph text laid out in a box, rather than point text.
+func (tt *TypeTool) IsBox() bool {
+	shape := tt.shape()
+	return shape != nil && shape.ShapeType == 1
+}
+
+// Box returns frame of paragraph text in text coordinates (see Transformation), nil for point text.
+func (tt *TypeTool) Box() *RectangleFloat {
+	shape := tt.shape()
+	if shape == nil || shape.ShapeType != 1 {
+		return nil
+	}
+	b := shape.Cookie.Photoshop.BoxBounds
+	if len(b) < 4 {
+		return nil
+	}
+	return &RectangleFloat{Left: b[0], Top: b[1], Right: b[2], Bottom: b[3]}
+}
+
+// shape returns the first text shape of engine data.
+func (tt *TypeTool) shape() *TextShape {
+	if tt.EngineData == nil || tt.EngineData.EngineDict == nil || tt.EngineData.EngineDict.Rendered == nil {
+		return nil
+	}
+	if shapes := tt.EngineData.EngineDict.Rendered.Shapes.Children; len(shapes) > 0 {
+		return shapes[0]
+	}
+	return nil
+}
+
+// ReadTypeTool reads "TySh" block of specified length.
+func ReadTypeTool(reader *util.Reader, length int) *TypeTool {
 	tt := new(TypeTool)
+	end := reader.Position + length
 	reader.Skip(2) // Version (= 1 for PS 6.0)
 	tt.Transformation = ReadMatrix(reader)
 
 	reader.Skip(2) // Text version (= 50 for PS 6.0)
 	reader.Skip(4) // Descriptor version (= 16 for PS 6.0)
 	tt.TextData = NewDescriptor(reader)
+	if item := tt.TextData.item("EngineData"); item != nil {
+		tt.EngineData = NewEngineData(item.Value)
+	}
+	if tt.TextData.truncated {
+		return tt
+	}
 
 	reader.Skip(2) // Warp version (= 1 for PS 6.0)
 	reader.Skip(4) // Descriptor version (= 16 for PS 6.0)
 	tt.WarpData = NewDescriptor(reader)
+	tt.Warp = NewWarp(tt.WarpData)
+	if tt.WarpData.truncated {
+		return tt
+	}
 
-	reader.Skip(32)
+	// Left, top, right and bottom. Specification describes them as doubles, but files
+	// saved by Photoshop CS+ contain 4-byte integers.
+	var left, top, right, bottom float64
+	switch {
+	case end-reader.Position >= 32:
+		left, top, right, bottom = reader.ReadFloat64(), reader.ReadFloat64(), reader.ReadFloat64(), reader.ReadFloat64()
+	case end-reader.Position >= 16:
+		left, top = float64(reader.ReadInt32()), float64(reader.ReadInt32())
+		right, bottom = float64(reader.ReadInt32()), float64(reader.ReadInt32())
+	default:
+		return tt
+	}
+	tt.Bounds = &RectangleFloat{Top: top, Left: left, Bottom: bottom, Right: right}
 
 	return tt
 }
@@ -32,11 +145,11 @@ type ObsoleteTypeTool struct {
 	Faces          []*TypeFace
 	Styles         []*TypeStyle
 
-	Type                                   int16
+	Type                                   int16 // 0 = point, 1 = paragraph
 	ScalingFactor, CharacterCount          int32
 	HorizontalPlacement, VerticalPlacement int32
 	SelectStart, SelectEnd                 int32
-	Lines                                  []*TextLine
+	Lines                                  []*TextLine // Runs of characters with their first character and style
 
 	ColorSpace int16
 	Color      *Color
@@ -44,11 +157,16 @@ type ObsoleteTypeTool struct {
 }
 
 type TypeFace struct {
-	Mark, Script                                       int16
-	FontName, FontFamily, FontStyle                    string
-	FontType, DesignVectorAxesCount, DesignVectorValue int32
+	Mark                            int16
+	Script                          int16 // Mac script code of font names, 1 = Japanese
+	FontName, FontFamily, FontStyle string
+	FontType, DesignVectorAxesCount int32
+	DesignVectorValues              []int32
+
+	legacyNames [3]string // Pascal strings of names as is
 }
 
+// TypeStyle is a character style, sizes are 16.16 fixed point numbers.
 type TypeStyle struct {
 	Mark, FaceMark                              int16
 	Size, Tracking, Kerning, Leading, BaseShift int32
@@ -61,8 +179,9 @@ type TextLine struct {
 	ActCharacter                  string
 }
 
-func ReadObsoleteTypeTool(reader *util.Reader) *ObsoleteTypeTool {
+func ReadObsoleteTypeTool(reader *util.Reader, length int) *ObsoleteTypeTool {
 	tt := new(ObsoleteTypeTool)
+	end := reader.Position + length
 
 	reader.Skip(2) // Version (= 1)
 	tt.Transformation = ReadMatrix(reader)
@@ -74,17 +193,20 @@ func ReadObsoleteTypeTool(reader *util.Reader) *ObsoleteTypeTool {
 		face := new(TypeFace)
 		face.Mark = reader.ReadInt16()
 		face.FontType = reader.ReadInt32()
-		face.FontName = reader.ReadPascalString()
-		face.FontFamily = reader.ReadPascalString()
-		face.FontStyle = reader.ReadPascalString()
+		face.legacyNames = [3]string{reader.ReadPascalString(), reader.ReadPascalString(), reader.ReadPascalString()}
 		face.Script = reader.ReadInt16()
+		face.DecodeNames(nil)
 		face.DesignVectorAxesCount = reader.ReadInt32()
-		face.DesignVectorValue = reader.ReadInt32()
+		face.DesignVectorValues = make([]int32, face.DesignVectorAxesCount)
+		for j := range face.DesignVectorValues {
+			face.DesignVectorValues[j] = reader.ReadInt32()
+		}
 		tt.Faces[i] = face
 	}
 
 	// Style information
 	tt.Styles = make([]*TypeStyle, reader.ReadInt16())
+	extraByte := obsoleteStyleHasExtraByte(reader, len(tt.Styles), end)
 	for i := 0; i < len(tt.Styles); i++ {
 		style := new(TypeStyle)
 		style.Mark = reader.ReadInt16()
@@ -95,8 +217,11 @@ func ReadObsoleteTypeTool(reader *util.Reader) *ObsoleteTypeTool {
 		style.Leading = reader.ReadInt32()
 		style.BaseShift = reader.ReadInt32()
 		style.AutoKern = reader.ReadByte() == 1
-		reader.Skip(1) // CHECK: Only present in version <= 5
+		if extraByte {
+			reader.Skip(1)
+		}
 		style.Rotate = reader.ReadByte() == 1
+		tt.Styles[i] = style
 	}
 
 	// Text information
@@ -115,6 +240,7 @@ func ReadObsoleteTypeTool(reader *util.Reader) *ObsoleteTypeTool {
 		line.Alignment = reader.ReadInt16()
 		line.ActCharacter = reader.ReadUnicodeStringLen(1)
 		line.Style = reader.ReadInt16()
+		tt.Lines[i] = line
 	}
 
 	// Color information
@@ -124,3 +250,38 @@ func ReadObsoleteTypeTool(reader *util.Reader) *ObsoleteTypeTool {
 
 	return tt
 }
+
+// DecodeNames decodes font names with charset of script, or with charset for Roman script (0).
+// Nil charset is MacRoman.
+func (f *TypeFace) DecodeNames(charset encoding.Encoding) {
+	if f.Script != 0 || charset == nil {
+		charset = util.ScriptCharset(f.Script)
+	}
+	f.FontName = util.DecodeString(f.legacyNames[0], charset)
+	f.FontFamily = util.DecodeString(f.legacyNames[1], charset)
+	f.FontStyle = util.DecodeString(f.legacyNames[2], charset)
+}
+
+// obsoleteStyleHasExtraByte tells if style records have the byte which is documented as
+// "only present in version <= 5". Files don't agree with the version, so the size of the rest
+// of the block decides: it must fit styles, text header, lines (12 bytes each) and color.
+func obsoleteStyleHasExtraByte(reader *util.Reader, count, end int) bool {
+	const textHeader = 26
+	const color = 11
+	start := reader.Position
+	defer func() {
+		reader.Skip(start - reader.Position)
+	}()
+	for _, size := range []int{27, 26} {
+		offset := count*size + textHeader
+		if start+offset+2 > end {
+			continue
+		}
+		reader.Skip(start + offset - reader.Position)
+		lines := int(reader.ReadInt16())
+		if rest := end - (start + offset + 2 + 12*lines + color); rest == 0 || rest == 1 {
+			return size == 27
+		}
+	}
+	return true
+}
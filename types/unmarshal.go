@@ -0,0 +1,315 @@
+package types
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// DescriptorUnmarshaler is implemented by types that decode descriptor items themselves.
+type DescriptorUnmarshaler interface {
+	UnmarshalDescriptor(entity *DescriptorEntity) error
+}
+
+var (
+	unmarshalerType = reflect.TypeOf((*DescriptorUnmarshaler)(nil)).Elem()
+	colorType       = reflect.TypeOf(color.NRGBA{})
+)
+
+// Unmarshal decodes descriptor into struct pointed by v, in the style of encoding/json.
+// Fields are matched with items by "psd" tag, fields without tag are ignored (except embedded structs):
+//
+//	Opacity float64                `psd:"Opct"`      "doub", "UntF", "long" or "comp" item
+//	Color   color.NRGBA            `psd:"Clr "`      color descriptor of any color space
+//	Stops   []*Stop                `psd:"Clrs"`      "VlLs" list
+//	Light   Light                  `psd:"Lght,Lght"` nested descriptor, which must be of "Lght" class
+//	Other   map[string]interface{} `psd:",unknown"`  values of items without matching fields
+//
+// Enums decode into strings (or types based on string) as enum values, classes as class IDs and
+// references, aliases and text data as their values. Unit floats decode into numbers,
+// or into DescriptorUnitFloat fields if unit is needed. Types implementing DescriptorUnmarshaler
+// decode items themselves. Decoding is best-effort: items that don't fit their fields are skipped,
+// the rest are still decoded and returned error lists all skipped items.
+func Unmarshal(d *Descriptor, v interface{}) error {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("Unmarshal target must be a non-nil pointer to struct, got %T", v)
+	}
+	if d == nil {
+		return nil
+	}
+	return unmarshalDescriptor(d, value.Elem())
+}
+
+// descriptorTag is parsed "psd" tag of field.
+type descriptorTag struct {
+	key, class string
+	unknown    bool
+}
+
+func parseDescriptorTag(tag string) descriptorTag {
+	parts := strings.Split(tag, ",")
+	result := descriptorTag{key: parts[0]}
+	for _, part := range parts[1:] {
+		if part == "unknown" {
+			result.unknown = true
+		} else {
+			result.class = part
+		}
+	}
+	return result
+}
+
+// unmarshalErrors collects errors of skipped items.
+type unmarshalErrors []string
+
+func (e *unmarshalErrors) add(err error) {
+	if err != nil {
+		*e = append(*e, err.Error())
+	}
+}
+
+func (e unmarshalErrors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s", strings.Join(e, "; "))
+}
+
+func unmarshalDescriptor(d *Descriptor, value reflect.Value) error {
+	known := make(map[string]bool)
+	var unknown reflect.Value
+	var errs unmarshalErrors
+	unmarshalFields(d, value, known, &unknown, &errs)
+	if !unknown.IsValid() {
+		return errs.err()
+	}
+	for _, item := range d.Items {
+		if known[item.Key] {
+			continue
+		}
+		if unknown.IsNil() {
+			unknown.Set(reflect.MakeMap(unknown.Type()))
+		}
+		unknown.SetMapIndex(reflect.ValueOf(item.Key), reflect.ValueOf(&item.Value).Elem())
+	}
+	return errs.err()
+}
+
+// unmarshalFields fills fields of struct (including embedded ones), collecting used keys and errors.
+func unmarshalFields(d *Descriptor, value reflect.Value, known map[string]bool, unknown *reflect.Value, errs *unmarshalErrors) {
+	t := value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, tagged := field.Tag.Lookup("psd")
+		if !tagged {
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				unmarshalFields(d, value.Field(i), known, unknown, errs)
+			}
+			continue
+		}
+		if tag == "-" || field.PkgPath != "" {
+			continue
+		}
+
+		options := parseDescriptorTag(tag)
+		if options.unknown {
+			if field.Type != reflect.TypeOf(map[string]interface{}{}) {
+				errs.add(fmt.Errorf("Field %s of unknown items must be map[string]interface{}", field.Name))
+				continue
+			}
+			*unknown = value.Field(i)
+			continue
+		}
+		item := d.item(options.key)
+		if item == nil {
+			continue
+		}
+		known[item.Key] = true
+		errs.add(unmarshalEntity(item, options.class, value.Field(i)))
+	}
+}
+
+func unmarshalEntity(item *DescriptorEntity, class string, value reflect.Value) error {
+	if item.Value == nil {
+		return nil
+	}
+	if value.CanAddr() && value.Addr().Type().Implements(unmarshalerType) {
+		return value.Addr().Interface().(DescriptorUnmarshaler).UnmarshalDescriptor(item)
+	}
+	if value.Kind() == reflect.Ptr {
+		if value.Type().Implements(unmarshalerType) || value.Type() != reflect.TypeOf(item.Value) {
+			if value.IsNil() {
+				value.Set(reflect.New(value.Type().Elem()))
+			}
+			return unmarshalEntity(item, class, value.Elem())
+		}
+	}
+	source := reflect.ValueOf(item.Value)
+	if value.Kind() == reflect.Interface || source.Type().AssignableTo(value.Type()) {
+		value.Set(source)
+		return nil
+	}
+	if source.Kind() == reflect.Ptr && source.Elem().Type().AssignableTo(value.Type()) {
+		value.Set(source.Elem())
+		return nil
+	}
+	if item.Type == "tdta" && value.Kind() == reflect.String {
+		value.SetString(item.Raw)
+		return nil
+	}
+	mismatch := fmt.Errorf("Can't unmarshal [%s] item \"%s\" into %s", item.Type, item.Key, value.Type())
+	overflow := fmt.Errorf("Value of [%s] item \"%s\" overflows %s", item.Type, item.Key, value.Type())
+
+	switch v := item.Value.(type) {
+	case *Descriptor:
+		switch {
+		case value.Type() == colorType:
+			value.Set(reflect.ValueOf(readDescriptorColor(v)))
+			return nil
+		case value.Kind() == reflect.Struct:
+			if class != "" && v.Class != class {
+				return fmt.Errorf("Item \"%s\" has class \"%s\", expected \"%s\"", item.Key, v.Class, class)
+			}
+			return unmarshalDescriptor(v, value)
+		}
+	case *DescriptorObjectArray:
+		if value.Kind() == reflect.Struct {
+			return unmarshalDescriptor(v.Descriptor, value)
+		}
+	case []*DescriptorEntity:
+		if value.Kind() == reflect.Slice {
+			list := reflect.MakeSlice(value.Type(), len(v), len(v))
+			var errs unmarshalErrors
+			for i, entity := range v {
+				errs.add(unmarshalEntity(entity, class, list.Index(i)))
+			}
+			value.Set(list)
+			return errs.err()
+		}
+	case *DescriptorUnitFloats:
+		if value.Kind() == reflect.Slice && isNumber(value.Type().Elem().Kind()) {
+			list := reflect.MakeSlice(value.Type(), len(v.Values), len(v.Values))
+			for i, number := range v.Values {
+				if !setNumber(list.Index(i), number) {
+					return overflow
+				}
+			}
+			value.Set(list)
+			return nil
+		}
+	case *DescriptorEnum:
+		if value.Kind() == reflect.String {
+			value.SetString(v.Enum)
+			return nil
+		}
+	case *DescriptorClass:
+		if value.Kind() == reflect.String {
+			value.SetString(v.Class)
+			return nil
+		}
+	case *DescriptorPath:
+		if value.Kind() == reflect.String {
+			value.SetString(v.Path)
+			return nil
+		}
+	case string:
+		if value.Kind() == reflect.String {
+			value.SetString(v)
+			return nil
+		}
+	case bool:
+		if value.Kind() == reflect.Bool {
+			value.SetBool(v)
+			return nil
+		}
+	case []byte:
+		if value.Kind() == reflect.String {
+			value.SetString(string(v))
+			return nil
+		}
+	case int32:
+		if isNumber(value.Kind()) {
+			if !setInteger(value, int64(v)) {
+				return overflow
+			}
+			return nil
+		}
+	case int64:
+		if isNumber(value.Kind()) {
+			if !setInteger(value, v) {
+				return overflow
+			}
+			return nil
+		}
+	case float64, *DescriptorUnitFloat:
+		if isNumber(value.Kind()) {
+			if !setNumber(value, entityFloat(item, 0)) {
+				return overflow
+			}
+			return nil
+		}
+	}
+	return mismatch
+}
+
+func isNumber(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// setNumber sets number converted to kind of value. Returns false if number doesn't fit into it.
+func setNumber(value reflect.Value, number float64) bool {
+	switch value.Kind() {
+	case reflect.Float32, reflect.Float64:
+		if value.OverflowFloat(number) {
+			return false
+		}
+		value.SetFloat(number)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if math.IsNaN(number) || number < math.MinInt64 || number >= math.MaxInt64 || value.OverflowInt(int64(number)) {
+			return false
+		}
+		value.SetInt(int64(number))
+	default:
+		if math.IsNaN(number) || number < 0 || number >= math.MaxUint64 || value.OverflowUint(uint64(number)) {
+			return false
+		}
+		value.SetUint(uint64(number))
+	}
+	return true
+}
+
+// setInteger sets "long" and "comp" values without conversion through float64.
+// Returns false if number doesn't fit into value.
+func setInteger(value reflect.Value, number int64) bool {
+	switch value.Kind() {
+	case reflect.Float32, reflect.Float64:
+		value.SetFloat(float64(number))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if value.OverflowInt(number) {
+			return false
+		}
+		value.SetInt(number)
+	default:
+		if number < 0 || value.OverflowUint(uint64(number)) {
+			return false
+		}
+		value.SetUint(uint64(number))
+	}
+	return true
+}
+
+// unmarshal decodes descriptor into v, items which can't be decoded are listed in Warnings.
+func (d *Descriptor) unmarshal(v interface{}) {
+	if err := Unmarshal(d, v); err != nil && d != nil {
+		d.Warnings = append(d.Warnings, err.Error())
+	}
+}
@@ -0,0 +1,60 @@
+package types
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnmarshalIntegers(t *testing.T) {
+	d := &Descriptor{Items: []*DescriptorEntity{
+		{Key: "big ", Type: "comp", Value: int64(1<<60 + 1)},
+		{Key: "neg ", Type: "long", Value: int32(-1)},
+		{Key: "wide", Type: "long", Value: int32(1000)},
+		{Key: "dbl ", Type: "doub", Value: 2.5},
+		{Key: "text", Type: "TEXT", Value: "text"},
+		{Key: "last", Type: "long", Value: int32(7)},
+	}}
+	var v struct {
+		Big  int64   `psd:"big "`
+		Neg  uint32  `psd:"neg "`
+		Wide int8    `psd:"wide"`
+		Dbl  float64 `psd:"dbl "`
+		Text int     `psd:"text"`
+		Last int     `psd:"last"`
+	}
+	err := Unmarshal(d, &v)
+	if v.Big != 1<<60+1 {
+		t.Errorf("comp value %d isn't exact", v.Big)
+	}
+	if v.Neg != 0 || v.Wide != 0 {
+		t.Errorf("overflowing values are stored: %d, %d", v.Neg, v.Wide)
+	}
+	if v.Dbl != 2.5 || v.Last != 7 {
+		t.Errorf("items after skipped ones aren't decoded: %v, %d", v.Dbl, v.Last)
+	}
+	if err == nil {
+		t.Fatal("no error for skipped items")
+	}
+	for _, key := range []string{`"neg "`, `"wide"`, `"text"`} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("error %q doesn't list item %s", err, key)
+		}
+	}
+
+	d.unmarshal(&v)
+	if len(d.Warnings) != 1 {
+		t.Errorf("got %d warnings, want 1", len(d.Warnings))
+	}
+}
+
+func TestUnmarshalUnitFloatsOverflow(t *testing.T) {
+	d := &Descriptor{Items: []*DescriptorEntity{
+		{Key: "list", Type: "UnFl", Value: &DescriptorUnitFloats{"#Pxl", []float64{1, -2}}},
+	}}
+	var v struct {
+		List []uint8 `psd:"list"`
+	}
+	if err := Unmarshal(d, &v); err == nil || v.List != nil {
+		t.Errorf("negative values are stored into []uint8: %v, %v", v.List, err)
+	}
+}
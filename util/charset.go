@@ -0,0 +1,39 @@
+package util
+
+import (
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+)
+
+// DecodeString converts string of legacy encoding (Pascal strings) to valid UTF-8. Nil charset is MacRoman.
+func DecodeString(s string, charset encoding.Encoding) string {
+	if charset == nil {
+		charset = charmap.Macintosh
+	}
+	value, err := charset.NewDecoder().String(s)
+	if err != nil {
+		value = s
+	}
+	return strings.ToValidUTF8(value, "�")
+}
+
+// ScriptCharset returns charset of Mac script code: Shift-JIS for Japanese (1), MacRoman otherwise.
+func ScriptCharset(script int16) encoding.Encoding {
+	if script == 1 {
+		return japanese.ShiftJIS
+	}
+	return charmap.Macintosh
+}
+
+// IsASCII tells if string has no characters which depend on charset.
+func IsASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
@@ -12,14 +12,26 @@ import (
 var (
 	BlendModeKeys = map[string]string{
 		"pass": "Pass through", "norm": "Normal", "diss": "Dissolve",
-		"dark": "Darken", "mul": "Multiply", "idiv": "Color burn",
+		"dark": "Darken", "mul ": "Multiply", "idiv": "Color burn",
 		"lbrn": "Linear burn", "dkCl": "Darker color", "lite": "Lighten",
-		"scrn": "Screen", "div": "Color dodge", "lddg": "Linear dodge",
+		"scrn": "Screen", "div ": "Color dodge", "lddg": "Linear dodge",
 		"lgCl": "Lighter color", "over": "Overlay", "sLit": "Soft light",
 		"hLit": "Hard light", "vLit": "Vivid light", "lLit": "Linear light",
 		"pLit": "Pin light", "hMix": "Hard mix", "diff": "Difference",
 		"smud": "Exclusion", "fsub": "Subtract", "fdiv": "Divide",
-		"hue": "Hue", "sat": "Saturation", "colr": "Color", "lum": "Luminosity",
+		"hue ": "Hue", "sat ": "Saturation", "colr": "Color", "lum ": "Luminosity",
+	}
+	// DescriptorBlendModes maps "BlnM" enum values of descriptors to names of BlendModeKeys
+	DescriptorBlendModes = map[string]string{
+		"passThrough": "Pass through", "Nrml": "Normal", "Dslv": "Dissolve",
+		"Drkn": "Darken", "Mltp": "Multiply", "CBrn": "Color burn",
+		"linearBurn": "Linear burn", "darkerColor": "Darker color", "Lghn": "Lighten",
+		"Scrn": "Screen", "CDdg": "Color dodge", "linearDodge": "Linear dodge",
+		"lighterColor": "Lighter color", "Ovrl": "Overlay", "SftL": "Soft light",
+		"HrdL": "Hard light", "vividLight": "Vivid light", "linearLight": "Linear light",
+		"pinLight": "Pin light", "hardMix": "Hard mix", "Dfrn": "Difference",
+		"Xclu": "Exclusion", "blendSubtraction": "Subtract", "blendDivide": "Divide",
+		"H   ": "Hue", "Strt": "Saturation", "Clr ": "Color", "Lmns": "Luminosity",
 	}
 	ColorModes = map[int16]string{
 		0: "Bitmap", 1: "Grayscale", 2: "Indexed", 3: "RGB",
@@ -9,10 +9,12 @@ import (
 type Reader struct {
 	buf      *bytes.Reader
 	Position int // [CHECK] Must be int64?
+
+	data []byte
 }
 
 func NewReader(b []byte) *Reader {
-	return &Reader{bytes.NewReader(b), 0}
+	return &Reader{bytes.NewReader(b), 0, b}
 }
 
 func (r *Reader) ReadByte() byte {
@@ -94,16 +96,18 @@ func (r *Reader) ReadFloat64() float64 {
 	return value
 }
 
+// ReadPascalString reads string preceded by its length byte. Bytes are returned as is, see DecodeString.
 func (r *Reader) ReadPascalString() string {
-	var length byte
-	if err := binary.Read(r.buf, binary.BigEndian, &length); err != nil {
-		panic(err)
-	}
-	if length == 0 {
-		length = 1
+	return r.ReadString(int(r.ReadByte()))
+}
+
+// ReadPaddedPascalString reads Pascal string which takes (with length byte) a multiple of padding bytes.
+func (r *Reader) ReadPaddedPascalString(padding int) string {
+	value := r.ReadPascalString()
+	if size := len(value) + 1; size%padding != 0 {
+		r.Skip(padding - size%padding)
 	}
-	r.Position += 1
-	return r.ReadString(int(length))
+	return value
 }
 
 func (r *Reader) ReadUnicodeString() string {
@@ -165,6 +169,14 @@ func (r *Reader) Skip(number interface{}) {
 	}
 }
 
+// Rest returns bytes after current position without reading them.
+func (r *Reader) Rest() []byte {
+	if r.Position >= len(r.data) {
+		return nil
+	}
+	return r.data[r.Position:]
+}
+
 func (r *Reader) UnreadByte() {
 	if err := r.buf.UnreadByte(); err != nil {
 		panic(err)
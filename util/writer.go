@@ -0,0 +1,75 @@
+package util
+
+import (
+	"bytes"
+	"encoding/binary"
+	"unicode/utf16"
+)
+
+// Writer writes big endian values in the format read by Reader.
+type Writer struct {
+	buf bytes.Buffer
+}
+
+func NewWriter() *Writer {
+	return new(Writer)
+}
+
+// Bytes returns written data.
+func (w *Writer) Bytes() []byte {
+	return w.buf.Bytes()
+}
+
+func (w *Writer) Len() int {
+	return w.buf.Len()
+}
+
+func (w *Writer) WriteBytes(b []byte) {
+	w.buf.Write(b)
+}
+
+func (w *Writer) WriteBool(value bool) {
+	if value {
+		w.buf.WriteByte(1)
+	} else {
+		w.buf.WriteByte(0)
+	}
+}
+
+func (w *Writer) WriteString(s string) {
+	w.buf.WriteString(s)
+}
+
+func (w *Writer) WriteInt16(value int16) {
+	binary.Write(&w.buf, binary.BigEndian, value)
+}
+
+func (w *Writer) WriteInt32(value int32) {
+	binary.Write(&w.buf, binary.BigEndian, value)
+}
+
+func (w *Writer) WriteInt64(value int64) {
+	binary.Write(&w.buf, binary.BigEndian, value)
+}
+
+func (w *Writer) WriteFloat64(value float64) {
+	binary.Write(&w.buf, binary.BigEndian, value)
+}
+
+// WriteUnicodeString writes length (in UTF-16 code units) and UTF-16 string.
+func (w *Writer) WriteUnicodeString(s string) {
+	array := utf16.Encode([]rune(s))
+	w.WriteInt32(int32(len(array)))
+	binary.Write(&w.buf, binary.BigEndian, array)
+}
+
+// WriteDynamicString writes string with its length. Zero length is written for 4-character
+// codes, unless asString is true.
+func (w *Writer) WriteDynamicString(s string, asString bool) {
+	if len(s) == 4 && !asString {
+		w.WriteInt32(0)
+	} else {
+		w.WriteInt32(int32(len(s)))
+	}
+	w.buf.WriteString(s)
+}